@@ -0,0 +1,227 @@
+package webreq
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Authenticator adds credentials to every request it is set on
+type Authenticator interface {
+	Authenticate(ctx context.Context, req *http.Request) error
+}
+
+// RetryAuthenticator is an Authenticator whose credentials can go stale. When
+// a request is rejected with 401 Unauthorized, Invalidate is called and, when
+// it returns true, the request is authenticated and sent once more.
+type RetryAuthenticator interface {
+	Authenticator
+	Invalidate(ctx context.Context, response *http.Response) bool
+}
+
+// SensitiveQueryAuthenticator is an Authenticator that puts credentials in
+// the query string. The parameters it names are redacted from the errors and
+// dumps of the requests it authenticates, on top of those of the Redactor.
+type SensitiveQueryAuthenticator interface {
+	Authenticator
+	SensitiveQueryParams() []string
+}
+
+// AuthenticatorFunc adapts a function to the Authenticator interface
+type AuthenticatorFunc func(ctx context.Context, req *http.Request) error
+
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, req *http.Request) error {
+	return f(ctx, req)
+}
+
+// BasicAuth authenticates with HTTP basic authentication
+func BasicAuth(username string, password string) Authenticator {
+	return BasicAuthFrom(username, StaticSecret(password))
+}
+
+// BasicAuthFrom authenticates with HTTP basic authentication, resolving the
+// password when each request is sent
+func BasicAuthFrom(username string, password SecretSource) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, req *http.Request) error {
+		secret, err := password.Secret(ctx)
+		if err != nil {
+			return err
+		}
+		req.SetBasicAuth(username, secret)
+		return nil
+	})
+}
+
+// BearerToken authenticates with a static bearer token
+func BearerToken(token string) Authenticator {
+	return BearerTokenFrom(StaticSecret(token))
+}
+
+// BearerTokenFrom authenticates with a bearer token resolved when each request is sent
+func BearerTokenFrom(token SecretSource) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, req *http.Request) error {
+		secret, err := token.Secret(ctx)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+secret)
+		return nil
+	})
+}
+
+// APIKeyHeader sends an API key in the named header, such as X-Api-Key
+func APIKeyHeader(name string, key string) Authenticator {
+	return APIKeyHeaderFrom(name, StaticSecret(key))
+}
+
+// APIKeyHeaderFrom sends an API key resolved when each request is sent in the named header
+func APIKeyHeaderFrom(name string, key SecretSource) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, req *http.Request) error {
+		secret, err := key.Secret(ctx)
+		if err != nil {
+			return err
+		}
+		req.Header.Set(name, secret)
+		return nil
+	})
+}
+
+// APIKeyQuery sends an API key as the named query parameter
+func APIKeyQuery(name string, key string) Authenticator {
+	return APIKeyQueryFrom(name, StaticSecret(key))
+}
+
+// APIKeyQueryFrom sends an API key resolved when each request is sent as the named query parameter
+func APIKeyQueryFrom(name string, key SecretSource) Authenticator {
+	return &apiKeyQuery{name: name, key: key}
+}
+
+// apiKeyQuery is the SensitiveQueryAuthenticator behind APIKeyQueryFrom
+type apiKeyQuery struct {
+	name string
+	key  SecretSource
+}
+
+func (auth *apiKeyQuery) Authenticate(ctx context.Context, req *http.Request) error {
+	secret, err := auth.key.Secret(ctx)
+	if err != nil {
+		return err
+	}
+	query := req.URL.Query()
+	query.Set(auth.name, secret)
+	req.URL.RawQuery = query.Encode()
+	return nil
+}
+
+func (auth *apiKeyQuery) SensitiveQueryParams() []string {
+	return []string{auth.name}
+}
+
+// Token is an access token and when it stops being valid
+type Token struct {
+	AccessToken string
+	TokenType   string    // defaults to Bearer
+	Expiry      time.Time // zero never expires
+}
+
+// valid reports whether the token can be used for at least another leeway
+func (token *Token) valid(leeway time.Duration) bool {
+	if token == nil || token.AccessToken == "" {
+		return false
+	}
+	return token.Expiry.IsZero() || time.Now().Add(leeway).Before(token.Expiry)
+}
+
+// TokenSource returns access tokens, fetching new ones when asked
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// TokenSourceFunc adapts a function to the TokenSource interface
+type TokenSourceFunc func(ctx context.Context) (*Token, error)
+
+func (f TokenSourceFunc) Token(ctx context.Context) (*Token, error) {
+	return f(ctx)
+}
+
+// DefaultTokenLeeway is how long before expiry a cached token is replaced
+const DefaultTokenLeeway = 10 * time.Second
+
+// noAuth sends no credentials. Token endpoint requests use it so the
+// Client's own Authenticator, which may draw on the source being fetched,
+// never runs for them.
+type noAuth struct{}
+
+func (noAuth) Authenticate(ctx context.Context, req *http.Request) error {
+	return nil
+}
+
+// TokenAuthenticator authenticates with tokens from a TokenSource. Tokens
+// are cached until Leeway before they expire, and a 401 response drops the
+// cached token so the request is retried once with a fresh one.
+type TokenAuthenticator struct {
+	Source TokenSource
+	Leeway time.Duration
+
+	mu    sync.Mutex
+	token *Token
+}
+
+// NewTokenAuthenticator creates a TokenAuthenticator for source
+func NewTokenAuthenticator(source TokenSource) *TokenAuthenticator {
+	return &TokenAuthenticator{Source: source, Leeway: DefaultTokenLeeway}
+}
+
+// Authenticate sets the Authorization header from the cached or a new token
+func (auth *TokenAuthenticator) Authenticate(ctx context.Context, req *http.Request) error {
+	auth.mu.Lock()
+	token := auth.token
+	auth.mu.Unlock()
+
+	if !token.valid(auth.Leeway) {
+		var err error
+		token, err = auth.Source.Token(ctx)
+		if err != nil {
+			return err
+		}
+		if token == nil || token.AccessToken == "" {
+			return errors.New("token source returned an empty token")
+		}
+		auth.mu.Lock()
+		auth.token = token
+		auth.mu.Unlock()
+	}
+
+	req.Header.Set("Authorization", token.header())
+	return nil
+}
+
+// Invalidate drops the cached token after a 401 so the retry fetches a new
+// one, unless another request already replaced it
+func (auth *TokenAuthenticator) Invalidate(ctx context.Context, response *http.Response) bool {
+	auth.mu.Lock()
+	token := auth.token
+	if token != nil && response.Request != nil && response.Request.Header.Get("Authorization") == token.header() {
+		auth.token = nil
+	} else {
+		token = nil
+	}
+	auth.mu.Unlock()
+
+	if invalidator, ok := auth.Source.(TokenInvalidator); ok && token != nil {
+		invalidator.InvalidateToken(token)
+	}
+	return true
+}
+
+// header returns the Authorization header value for the token
+func (token *Token) header() string {
+	tokenType := token.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+	return tokenType + " " + token.AccessToken
+}
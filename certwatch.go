@@ -0,0 +1,167 @@
+package webreq
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultCertificatePollInterval is how often CertificateWatcher checks its files
+const DefaultCertificatePollInterval = 30 * time.Second
+
+// CertificateWatcherStats reports the reload history of a CertificateWatcher
+type CertificateWatcherStats struct {
+	Reloads    uint64 // successful reloads after the initial load
+	Failures   uint64
+	LastReload time.Time
+	LastError  error
+}
+
+// CertificateWatcher serves a client certificate from PEM files and reloads
+// it when they change, so rotated certificates are picked up by new
+// connections without rebuilding the Client or dropping its pool.
+type CertificateWatcher struct {
+	CertFile string
+	KeyFile  string
+
+	mu          sync.RWMutex
+	onReload    func(error)
+	certificate *tls.Certificate
+	certStamp   fileStamp
+	keyStamp    fileStamp
+	stats       CertificateWatcherStats
+	stop        chan struct{}
+	stopOnce    sync.Once
+}
+
+// fileStamp identifies a version of a file
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewCertificateWatcher loads the key pair and polls the files every interval,
+// or DefaultCertificatePollInterval when interval is not positive
+func NewCertificateWatcher(certFile string, keyFile string, interval time.Duration) (*CertificateWatcher, error) {
+	watcher := &CertificateWatcher{
+		CertFile: certFile,
+		KeyFile:  keyFile,
+		stop:     make(chan struct{}),
+	}
+	if err := watcher.load(); err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		interval = DefaultCertificatePollInterval
+	}
+	go watcher.poll(interval)
+	return watcher, nil
+}
+
+// SetOnReload sets a callback run after every reload attempt triggered by a
+// file change, with a nil error on success. The previous certificate stays in
+// use on failure.
+func (watcher *CertificateWatcher) SetOnReload(callback func(error)) *CertificateWatcher {
+	watcher.mu.Lock()
+	defer watcher.mu.Unlock()
+	watcher.onReload = callback
+	return watcher
+}
+
+// GetClientCertificate returns the current certificate, for use as tls.Config.GetClientCertificate
+func (watcher *CertificateWatcher) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	watcher.mu.RLock()
+	defer watcher.mu.RUnlock()
+	return watcher.certificate, nil
+}
+
+// Reload checks the files now and reloads the key pair if either changed
+func (watcher *CertificateWatcher) Reload() error {
+	certStamp, certErr := stampOf(watcher.CertFile)
+	keyStamp, keyErr := stampOf(watcher.KeyFile)
+
+	watcher.mu.RLock()
+	unchanged := certErr == nil && keyErr == nil &&
+		certStamp == watcher.certStamp && keyStamp == watcher.keyStamp
+	watcher.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	err := watcher.load()
+	watcher.mu.Lock()
+	if err != nil {
+		watcher.stats.Failures++
+		watcher.stats.LastError = err
+	} else {
+		watcher.stats.Reloads++
+		watcher.stats.LastError = nil
+	}
+	callback := watcher.onReload
+	watcher.mu.Unlock()
+
+	if callback != nil {
+		callback(err)
+	}
+	return err
+}
+
+// Stats returns the reload counters
+func (watcher *CertificateWatcher) Stats() CertificateWatcherStats {
+	watcher.mu.RLock()
+	defer watcher.mu.RUnlock()
+	return watcher.stats
+}
+
+// Close stops polling the files
+func (watcher *CertificateWatcher) Close() {
+	watcher.stopOnce.Do(func() {
+		close(watcher.stop)
+	})
+}
+
+func (watcher *CertificateWatcher) poll(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-watcher.stop:
+			return
+		case <-ticker.C:
+			_ = watcher.Reload()
+		}
+	}
+}
+
+// load reads the key pair, recording the file versions it came from
+func (watcher *CertificateWatcher) load() error {
+	certStamp, err := stampOf(watcher.CertFile)
+	if err != nil {
+		return err
+	}
+	keyStamp, err := stampOf(watcher.KeyFile)
+	if err != nil {
+		return err
+	}
+	certificate, err := tls.LoadX509KeyPair(watcher.CertFile, watcher.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	watcher.mu.Lock()
+	defer watcher.mu.Unlock()
+	watcher.certificate = &certificate
+	watcher.certStamp = certStamp
+	watcher.keyStamp = keyStamp
+	watcher.stats.LastReload = time.Now()
+	return nil
+}
+
+func stampOf(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
@@ -0,0 +1,288 @@
+package webreq
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client holds settings shared by every Request executed through it.
+// Requests without a Client use the package's shared default client.
+type Client struct {
+	mu          sync.Mutex
+	httpClient  *http.Client
+	Compression *Compression
+	Headers     HeadersMap // sent with every request unless the request sets the same header
+	Jar         http.CookieJar
+	// RedirectPolicy applies to requests that have none of their own
+	RedirectPolicy *RedirectPolicy
+	Proxy          *ProxyConfig // nil uses the proxy environment variables
+	TLS            *TLSConfig
+	// Resolve maps "host:port" to the addresses dialled instead, like curl --resolve.
+	// The URL, Host header and TLS server name are left untouched.
+	Resolve  map[string][]string
+	Resolver Resolver // nil uses the system resolver
+	// UnixSocket, when set, is dialled for every request instead of the URL host
+	UnixSocket string
+	// UnixSocketURLs enables http+unix URLs, see SchemeHTTPUnix. They are
+	// also enabled by UnixSocket.
+	UnixSocketURLs bool
+	Timeouts       *Timeouts // defaults for requests, see Request.SetTimeouts
+	// MinTransferRate applies to requests that have none of their own
+	MinTransferRate *TransferRate
+	// MaxResponseHeaderBytes limits the response header size, zero uses the net/http default of 1MB
+	MaxResponseHeaderBytes int64
+	// Egress restricts the addresses, ports and schemes the Client may connect to
+	Egress *EgressPolicy
+	// Policy allowlists the hosts, paths and methods requests may use
+	Policy *Policy
+	// Redactor hides secrets in errors and dumps, defaults to NewRedactor
+	Redactor *Redactor
+	// Auth authenticates requests that have no Authenticator of their own
+	Auth Authenticator
+	// SignatureVerifier verifies responses of requests that have none of their own
+	SignatureVerifier *MessageVerifier
+	// CollectTimings aggregates the Timings of the Client's requests, see TimingStats
+	CollectTimings bool
+
+	statsMu sync.Mutex
+	stats   TimingStats
+}
+
+// NewClient creates a new Client with the same pooling defaults as the shared client
+func NewClient() *Client {
+	return &Client{}
+}
+
+// SetCompression sets the request body compression used by requests that have none of their own.
+func (client *Client) SetCompression(compression *Compression) *Client {
+	client.Compression = compression
+	return client
+}
+
+// SetHeader sets a default header sent with every request
+func (client *Client) SetHeader(key string, value string) *Client {
+	if key == "" || value == "" {
+		return client
+	}
+	if client.Headers == nil {
+		client.Headers = make(HeadersMap)
+	}
+	client.Headers[key] = value
+	return client
+}
+
+// SetJar sets the cookie jar used to store and send cookies
+func (client *Client) SetJar(jar http.CookieJar) *Client {
+	client.Jar = jar
+	client.reset()
+	return client
+}
+
+// SetRedirectPolicy sets the redirect policy used by requests that have none of their own
+func (client *Client) SetRedirectPolicy(policy *RedirectPolicy) *Client {
+	client.RedirectPolicy = policy
+	return client
+}
+
+// SetProxy sets how requests are routed through proxies
+func (client *Client) SetProxy(config *ProxyConfig) *Client {
+	client.Proxy = config
+	client.reset()
+	return client
+}
+
+// SetTLSConfig sets the TLS settings used for https requests
+func (client *Client) SetTLSConfig(config *TLSConfig) *Client {
+	client.TLS = config
+	client.reset()
+	return client
+}
+
+// AddResolve connects to addresses, IPs with an optional port, instead of resolving hostPort
+func (client *Client) AddResolve(hostPort string, addresses ...string) *Client {
+	if len(addresses) == 0 {
+		return client
+	}
+	if client.Resolve == nil {
+		client.Resolve = make(map[string][]string)
+	}
+	key := strings.ToLower(hostPort)
+	client.Resolve[key] = append(client.Resolve[key], addresses...)
+	client.reset()
+	return client
+}
+
+// SetResolver sets the Resolver used to look up hosts before dialling
+func (client *Client) SetResolver(resolver Resolver) *Client {
+	client.Resolver = resolver
+	client.reset()
+	return client
+}
+
+// SetUnixSocket sends every request of the client over the Unix domain socket at path
+func (client *Client) SetUnixSocket(path string) *Client {
+	client.UnixSocket = path
+	client.reset()
+	return client
+}
+
+// SetUnixSocketURLs enables http+unix URLs on the client's requests
+func (client *Client) SetUnixSocketURLs(enabled bool) *Client {
+	client.UnixSocketURLs = enabled
+	client.reset()
+	return client
+}
+
+func (client *Client) unixSocketURLs() bool {
+	return client.UnixSocketURLs || client.UnixSocket != ""
+}
+
+// SetTimeouts sets the per-phase timeouts used when a request doesn't set its own
+func (client *Client) SetTimeouts(timeouts Timeouts) *Client {
+	client.Timeouts = &timeouts
+	return client
+}
+
+// SetMinTransferRate aborts response bodies when fewer than bytes arrive within
+// any window, windows under 100ms are raised to 100ms
+func (client *Client) SetMinTransferRate(bytes int64, window time.Duration) *Client {
+	if bytes > 0 && window > 0 {
+		client.MinTransferRate = newTransferRate(bytes, window)
+	}
+	return client
+}
+
+// SetMaxResponseHeaderBytes limits how many bytes of response headers are read
+func (client *Client) SetMaxResponseHeaderBytes(size int64) *Client {
+	if size > 0 {
+		client.MaxResponseHeaderBytes = size
+		client.reset()
+	}
+	return client
+}
+
+// SetEgressPolicy restricts where the Client may connect, see EgressPolicy
+func (client *Client) SetEgressPolicy(policy *EgressPolicy) *Client {
+	client.Egress = policy
+	client.reset()
+	return client
+}
+
+// SetPolicy sets the Policy evaluated before each request is sent
+func (client *Client) SetPolicy(policy *Policy) *Client {
+	client.Policy = policy
+	return client
+}
+
+// SetRedactor sets the Redactor used for errors and dumps of the Client's requests
+func (client *Client) SetRedactor(redactor *Redactor) *Client {
+	client.Redactor = redactor
+	return client
+}
+
+// SetAuth sets the Authenticator applied to the Client's requests
+func (client *Client) SetAuth(auth Authenticator) *Client {
+	client.Auth = auth
+	return client
+}
+
+// SetSignatureVerifier verifies the HTTP message signatures of the Client's responses
+func (client *Client) SetSignatureVerifier(verifier *MessageVerifier) *Client {
+	client.SignatureVerifier = verifier
+	return client
+}
+
+// SetCollectTimings enables aggregating the Timings of the Client's requests
+func (client *Client) SetCollectTimings(enabled bool) *Client {
+	client.CollectTimings = enabled
+	return client
+}
+
+// TimingStats returns the Timings aggregated since the last ResetTimingStats
+func (client *Client) TimingStats() TimingStats {
+	client.statsMu.Lock()
+	defer client.statsMu.Unlock()
+	return client.stats
+}
+
+// ResetTimingStats clears the aggregated Timings
+func (client *Client) ResetTimingStats() {
+	client.statsMu.Lock()
+	defer client.statsMu.Unlock()
+	client.stats = TimingStats{}
+}
+
+func (client *Client) recordTimings(timings Timings) {
+	if !client.CollectTimings {
+		return
+	}
+	client.statsMu.Lock()
+	defer client.statsMu.Unlock()
+	client.stats.add(timings)
+}
+
+// HTTPClient returns the underlying http.Client, building it on first use
+func (client *Client) HTTPClient() *http.Client {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if client.httpClient == nil {
+		client.httpClient = client.build()
+	}
+	return client.httpClient
+}
+
+// reset drops the built http.Client so the next request picks up new settings
+func (client *Client) reset() {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if client.httpClient != nil {
+		client.httpClient.CloseIdleConnections()
+	}
+	client.httpClient = nil
+}
+
+// build creates the http.Client from the current settings
+func (client *Client) build() *http.Client {
+	transport := &http.Transport{
+		MaxIdleConns:           100,
+		MaxIdleConnsPerHost:    10,
+		IdleConnTimeout:        90 * time.Second,
+		Proxy:                  http.ProxyFromEnvironment,
+		ForceAttemptHTTP2:      true,
+		DialContext:            client.newDialer().DialContext,
+		MaxResponseHeaderBytes: client.MaxResponseHeaderBytes,
+	}
+	if client.unixSocketURLs() {
+		transport.RegisterProtocol(SchemeHTTPUnix, newUnixTransport())
+	}
+	if client.TLS != nil {
+		transport.TLSClientConfig = client.TLS.build()
+		if len(client.TLS.Pins) > 0 {
+			transport.DialTLSContext = client.TLS.dialPinned(transport.DialContext, transport.TLSClientConfig)
+		}
+	}
+	if client.Egress != nil {
+		// an environment proxy would dial targets the policy never sees
+		transport.Proxy = nil
+	}
+	if client.Proxy != nil {
+		transport.Proxy = client.Proxy.proxy
+		transport.GetProxyConnectHeader = client.Proxy.connectHeader
+	}
+	httpClient := &http.Client{
+		Transport:     transport,
+		Jar:           client.Jar,
+		CheckRedirect: checkRedirect,
+	}
+	if egress := client.Egress; egress != nil {
+		httpClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if err := egress.checkRequest(req); err != nil {
+				return err
+			}
+			return checkRedirect(req, via)
+		}
+	}
+	return httpClient
+}
@@ -0,0 +1,120 @@
+package webreq
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	CompressionGzip = "gzip"
+	// CompressionDeflate is the zlib format (RFC 1950), as HTTP's deflate
+	// Content-Encoding requires, not raw DEFLATE
+	CompressionDeflate = "deflate"
+	// CompressionZstd takes zstd levels (1 to 22), mapped to the nearest
+	// encoder speed
+	CompressionZstd = "zstd"
+	// DefaultCompressionThreshold is the smallest body that gets compressed (1KB)
+	DefaultCompressionThreshold = 1024
+)
+
+// Compressor wraps w so that everything written to it is encoded at the given level.
+// A level of zero asks the compressor for its own default.
+type Compressor func(w io.Writer, level int) (io.WriteCloser, error)
+
+var (
+	compressorsMu sync.RWMutex
+	compressors   = map[string]Compressor{
+		CompressionGzip: func(w io.Writer, level int) (io.WriteCloser, error) {
+			if level == 0 {
+				level = gzip.DefaultCompression
+			}
+			return gzip.NewWriterLevel(w, level)
+		},
+		CompressionDeflate: func(w io.Writer, level int) (io.WriteCloser, error) {
+			if level == 0 {
+				level = zlib.DefaultCompression
+			}
+			return zlib.NewWriterLevel(w, level)
+		},
+		CompressionZstd: func(w io.Writer, level int) (io.WriteCloser, error) {
+			// bodies are encoded in one go, so there is nothing to gain from
+			// the encoder's background goroutines
+			options := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+			if level != 0 {
+				options = append(options, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+			}
+			return zstd.NewWriter(w, options...)
+		},
+	}
+)
+
+// RegisterCompressor makes a Content-Encoding available to Compression.
+// gzip, deflate and zstd are built in; registering one of them again
+// replaces the built-in encoder.
+func RegisterCompressor(encoding string, compressor Compressor) {
+	compressorsMu.Lock()
+	defer compressorsMu.Unlock()
+	compressors[encoding] = compressor
+}
+
+// Compression describes how request bodies are encoded before being sent
+type Compression struct {
+	Algorithm string
+	Level     int // zero uses the algorithm's default level
+	Threshold int // bodies shorter than this are sent as-is
+}
+
+// NewCompression creates a Compression for the given Content-Encoding with the default threshold
+func NewCompression(algorithm string) *Compression {
+	return &Compression{
+		Algorithm: algorithm,
+		Threshold: DefaultCompressionThreshold,
+	}
+}
+
+// SetLevel sets the compression level passed to the compressor
+func (compression *Compression) SetLevel(level int) *Compression {
+	compression.Level = level
+	return compression
+}
+
+// SetThreshold sets the minimum body size in bytes that gets compressed
+func (compression *Compression) SetThreshold(size int) *Compression {
+	if size >= 0 {
+		compression.Threshold = size
+	}
+	return compression
+}
+
+// compress encodes data, reporting false when the body is below the threshold
+func (compression *Compression) compress(data []byte) ([]byte, bool, error) {
+	if len(data) == 0 || len(data) < compression.Threshold {
+		return data, false, nil
+	}
+
+	compressorsMu.RLock()
+	compressor, ok := compressors[compression.Algorithm]
+	compressorsMu.RUnlock()
+	if !ok {
+		return nil, false, fmt.Errorf("compression algorithm %q is not registered", compression.Algorithm)
+	}
+
+	var buffer bytes.Buffer
+	writer, err := compressor(&buffer, compression.Level)
+	if err != nil {
+		return nil, false, err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return nil, false, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, false, err
+	}
+	return buffer.Bytes(), true, nil
+}
@@ -0,0 +1,258 @@
+package webreq
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// netscapeHTTPOnlyPrefix marks HttpOnly cookies in cookies.txt files
+const netscapeHTTPOnlyPrefix = "#HttpOnly_"
+
+// HostOnlySuffixList is a strict cookiejar.PublicSuffixList that treats every
+// domain as public, so a Domain attribute is only accepted when it names the
+// responding host itself and cookies are never shared with other hosts
+var HostOnlySuffixList cookiejar.PublicSuffixList = hostOnlySuffixList{}
+
+type hostOnlySuffixList struct{}
+
+func (hostOnlySuffixList) PublicSuffix(domain string) string {
+	return domain
+}
+
+func (hostOnlySuffixList) String() string {
+	return "webreq host-only suffix list"
+}
+
+// jarEntry is a cookie accepted by the jar, kept so it can be exported
+type jarEntry struct {
+	cookie   http.Cookie
+	hostOnly bool
+}
+
+// Jar is an RFC 6265 cookie jar that, unlike cookiejar.Jar, can list and
+// export the cookies it holds.
+type Jar struct {
+	mu               sync.Mutex
+	jar              *cookiejar.Jar
+	publicSuffixList cookiejar.PublicSuffixList
+	entries          map[string]jarEntry
+}
+
+// NewJar creates a Jar using the given public suffix list, or publicsuffix.List when nil
+func NewJar(publicSuffixList cookiejar.PublicSuffixList) *Jar {
+	if publicSuffixList == nil {
+		publicSuffixList = publicsuffix.List
+	}
+	// cookiejar.New never returns an error
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicSuffixList})
+	return &Jar{
+		jar:              jar,
+		publicSuffixList: publicSuffixList,
+		entries:          make(map[string]jarEntry),
+	}
+}
+
+// Cookies returns the cookies to send in a request for u
+func (jar *Jar) Cookies(u *url.URL) []*http.Cookie {
+	return jar.jar.Cookies(u)
+}
+
+// SetCookies stores the cookies received in a response from u
+func (jar *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	jar.mu.Lock()
+	defer jar.mu.Unlock()
+
+	jar.jar.SetCookies(u, cookies)
+	now := time.Now()
+	for _, cookie := range cookies {
+		entry := jarEntry{cookie: *cookie}
+		entry.cookie.Path = cookiePath(u, cookie)
+		entry.cookie.Domain = strings.TrimPrefix(strings.ToLower(cookie.Domain), ".")
+		entry.hostOnly = jar.hostOnly(u.Hostname(), entry.cookie.Domain)
+		if entry.hostOnly {
+			entry.cookie.Domain = strings.ToLower(u.Hostname())
+		}
+		if cookie.MaxAge > 0 {
+			entry.cookie.Expires = now.Add(time.Duration(cookie.MaxAge) * time.Second)
+		}
+		key := entry.cookie.Domain + ";" + entry.cookie.Path + ";" + cookie.Name
+
+		expired := cookie.MaxAge < 0 || (!entry.cookie.Expires.IsZero() && !entry.cookie.Expires.After(now))
+		if expired {
+			delete(jar.entries, key)
+			continue
+		}
+		if jar.accepted(u, &entry.cookie) {
+			jar.entries[key] = entry
+		}
+	}
+}
+
+// hostOnly reports whether the underlying jar stores a cookie for domain as
+// host-only: it does so without a Domain attribute, for IP hosts and when
+// the Domain is a public suffix naming the host itself
+func (jar *Jar) hostOnly(host string, domain string) bool {
+	if domain == "" || net.ParseIP(host) != nil {
+		return true
+	}
+	return jar.publicSuffixList.PublicSuffix(domain) == domain
+}
+
+// accepted reports whether the underlying jar kept the cookie, as it may
+// reject cookies for foreign or public suffix domains
+func (jar *Jar) accepted(u *url.URL, cookie *http.Cookie) bool {
+	check := url.URL{Scheme: u.Scheme, Host: u.Host, Path: cookie.Path}
+	if cookie.Secure {
+		check.Scheme = "https"
+	}
+	for _, stored := range jar.jar.Cookies(&check) {
+		if stored.Name == cookie.Name && stored.Value == cookie.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// AllCookies returns every unexpired cookie in the jar with its Domain and Path filled in
+func (jar *Jar) AllCookies() []*http.Cookie {
+	jar.mu.Lock()
+	defer jar.mu.Unlock()
+
+	now := time.Now()
+	cookies := make([]*http.Cookie, 0, len(jar.entries))
+	for key, entry := range jar.entries {
+		if !entry.cookie.Expires.IsZero() && !entry.cookie.Expires.After(now) {
+			delete(jar.entries, key)
+			continue
+		}
+		cookie := entry.cookie
+		cookies = append(cookies, &cookie)
+	}
+	return cookies
+}
+
+// Export writes the jar in the Netscape cookies.txt format used by curl and wget.
+// Each line holds domain, include-subdomains flag, path, secure flag, expiry as
+// Unix seconds (0 for session cookies), name and value separated by tabs;
+// HttpOnly cookies are prefixed with #HttpOnly_.
+func (jar *Jar) Export(w io.Writer) error {
+	jar.mu.Lock()
+	entries := make([]jarEntry, 0, len(jar.entries))
+	for _, entry := range jar.entries {
+		entries = append(entries, entry)
+	}
+	jar.mu.Unlock()
+
+	if _, err := io.WriteString(w, "# Netscape HTTP Cookie File\n"); err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, entry := range entries {
+		cookie := entry.cookie
+		if !cookie.Expires.IsZero() && !cookie.Expires.After(now) {
+			continue
+		}
+		domain := cookie.Domain
+		if !entry.hostOnly {
+			domain = "." + domain
+		}
+		if cookie.HttpOnly {
+			domain = netscapeHTTPOnlyPrefix + domain
+		}
+		var expires int64
+		if !cookie.Expires.IsZero() {
+			expires = cookie.Expires.Unix()
+		}
+		_, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			domain, netscapeBool(!entry.hostOnly), cookie.Path, netscapeBool(cookie.Secure),
+			expires, cookie.Name, cookie.Value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Import reads cookies in the Netscape cookies.txt format written by Export.
+// Expired cookies are skipped.
+func (jar *Jar) Import(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+
+		httpOnly := strings.HasPrefix(line, netscapeHTTPOnlyPrefix)
+		if httpOnly {
+			line = strings.TrimPrefix(line, netscapeHTTPOnlyPrefix)
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return fmt.Errorf("cookies line %d: expected 7 fields, got %d", lineNumber, len(fields))
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return fmt.Errorf("cookies line %d: invalid expiry %q", lineNumber, fields[4])
+		}
+
+		domain := strings.TrimPrefix(fields[0], ".")
+		cookie := &http.Cookie{
+			Name:     fields[5],
+			Value:    fields[6],
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			HttpOnly: httpOnly,
+		}
+		if strings.EqualFold(fields[1], "TRUE") {
+			cookie.Domain = domain
+		}
+		if expires > 0 {
+			cookie.Expires = time.Unix(expires, 0)
+			if !cookie.Expires.After(time.Now()) {
+				continue
+			}
+		}
+
+		origin := &url.URL{Scheme: "http", Host: domain, Path: cookie.Path}
+		if cookie.Secure {
+			origin.Scheme = "https"
+		}
+		jar.SetCookies(origin, []*http.Cookie{cookie})
+	}
+	return scanner.Err()
+}
+
+// cookiePath returns the cookie's path, or the default path derived from u per RFC 6265 section 5.1.4
+func cookiePath(u *url.URL, cookie *http.Cookie) string {
+	if strings.HasPrefix(cookie.Path, "/") {
+		return cookie.Path
+	}
+	path := u.Path
+	i := strings.LastIndexByte(path, '/')
+	if i <= 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+func netscapeBool(value bool) string {
+	if value {
+		return "TRUE"
+	}
+	return "FALSE"
+}
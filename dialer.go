@@ -0,0 +1,276 @@
+package webreq
+
+import (
+	"context"
+	"net"
+	"net/http/httptrace"
+	"strings"
+	"time"
+)
+
+// Resolver looks up the IP addresses of a host. *net.Resolver implements it.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// dialer connects a Client's transport, applying resolve overrides, its
+// Resolver and its EgressPolicy
+type dialer struct {
+	net        net.Dialer
+	resolve    map[string][]string
+	resolver   Resolver // nil dials through net.Dialer's own lookup
+	unixSocket string
+	egress     *EgressPolicy
+}
+
+// fallbackDelay is how long the first address family gets before the other
+// one is raced against it, as net.Dialer does by default
+const fallbackDelay = 300 * time.Millisecond
+
+func newNetDialer() net.Dialer {
+	return net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+}
+
+func (client *Client) newDialer() *dialer {
+	return &dialer{
+		net:        newNetDialer(),
+		resolve:    client.Resolve,
+		resolver:   client.Resolver,
+		unixSocket: client.UnixSocket,
+		egress:     client.Egress,
+	}
+}
+
+// DialContext is used as http.Transport.DialContext
+func (d *dialer) DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	return dialWithTimeout(d.dial)(ctx, network, address)
+}
+
+// dialWithTimeout applies the dial timeout of the executing Request to dial,
+// covering both lookup and connect
+func dialWithTimeout(dial func(context.Context, string, string) (net.Conn, error)) func(context.Context, string, string) (net.Conn, error) {
+	return func(ctx context.Context, network string, address string) (net.Conn, error) {
+		dog := watchdogFrom(ctx)
+		if dog == nil || dog.timeouts.Dial <= 0 {
+			return dial(ctx, network, address)
+		}
+
+		dialCtx, cancel := context.WithTimeout(ctx, dog.timeouts.Dial)
+		defer cancel()
+		conn, err := dial(dialCtx, network, address)
+		if err != nil && dialCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+			return nil, &TimeoutError{Phase: TimeoutPhaseDial, Limit: dog.timeouts.Dial, Err: err}
+		}
+		return conn, err
+	}
+}
+
+func (d *dialer) dial(ctx context.Context, network string, address string) (net.Conn, error) {
+	if d.unixSocket != "" {
+		return d.net.DialContext(ctx, "unix", d.unixSocket)
+	}
+	if _, ok := d.resolve[strings.ToLower(address)]; !ok && d.resolver == nil && d.egress == nil {
+		// nothing to apply, net.Dialer already races the address families
+		return d.net.DialContext(ctx, network, address)
+	}
+
+	if d.net.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.net.Timeout)
+		defer cancel()
+	}
+	candidates, err := d.lookup(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	var allowed []string
+	var denied error
+	for _, candidate := range candidates {
+		if d.egress != nil {
+			if err := d.egress.checkAddress(candidate); err != nil {
+				denied = err
+				continue
+			}
+		}
+		allowed = append(allowed, candidate)
+	}
+	if len(allowed) == 0 {
+		return nil, denied
+	}
+	primaries, fallbacks := partitionCandidates(allowed)
+	return d.dialParallel(ctx, network, primaries, fallbacks)
+}
+
+// partitionCandidates splits candidates into those of the first one's
+// address family and the rest
+func partitionCandidates(candidates []string) (primaries []string, fallbacks []string) {
+	for _, candidate := range candidates {
+		if isIPv4Candidate(candidate) == isIPv4Candidate(candidates[0]) {
+			primaries = append(primaries, candidate)
+		} else {
+			fallbacks = append(fallbacks, candidate)
+		}
+	}
+	return primaries, fallbacks
+}
+
+func isIPv4Candidate(candidate string) bool {
+	host, _, _ := net.SplitHostPort(candidate)
+	ip := net.ParseIP(host)
+	return ip != nil && ip.To4() != nil
+}
+
+// dialParallel races the fallbacks against the primaries once the primaries
+// have had fallbackDelay, returning the first connection made
+func (d *dialer) dialParallel(ctx context.Context, network string, primaries []string, fallbacks []string) (net.Conn, error) {
+	if len(fallbacks) == 0 {
+		return d.dialSerial(ctx, network, primaries)
+	}
+
+	type dialResult struct {
+		conn    net.Conn
+		err     error
+		primary bool
+	}
+	returned := make(chan struct{})
+	defer close(returned)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan dialResult)
+	race := func(primary bool, candidates []string) {
+		conn, err := d.dialSerial(ctx, network, candidates)
+		select {
+		case results <- dialResult{conn: conn, err: err, primary: primary}:
+		case <-returned:
+			if conn != nil {
+				conn.Close()
+			}
+		}
+	}
+
+	delay := d.net.FallbackDelay
+	if delay <= 0 {
+		delay = fallbackDelay
+	}
+	go race(true, primaries)
+	fallbackTimer := time.NewTimer(delay)
+	defer fallbackTimer.Stop()
+
+	var primaryErr error
+	pending := 2
+	for {
+		select {
+		case <-fallbackTimer.C:
+			go race(false, fallbacks)
+		case result := <-results:
+			if result.err == nil {
+				return result.conn, nil
+			}
+			if result.primary {
+				primaryErr = result.err
+				// the primaries failed early, start the fallbacks now
+				if fallbackTimer.Stop() {
+					fallbackTimer.Reset(0)
+				}
+			} else if primaryErr == nil {
+				primaryErr = result.err
+			}
+			if pending--; pending == 0 {
+				return nil, primaryErr
+			}
+		}
+	}
+}
+
+// dialSerial tries candidates in order, giving each an equal share of the
+// time left so that an unresponsive address does not use up the whole budget
+func (d *dialer) dialSerial(ctx context.Context, network string, candidates []string) (net.Conn, error) {
+	var lastErr error
+	for i, candidate := range candidates {
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if deadline, ok := partialDeadline(ctx, len(candidates)-i); ok {
+			attemptCtx, cancel = context.WithDeadline(ctx, deadline)
+		}
+		conn, err := d.net.DialContext(attemptCtx, network, candidate)
+		cancel()
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// partialDeadline returns the deadline of one of remaining attempts, which
+// is never cut below two seconds unless the overall deadline is closer
+func partialDeadline(ctx context.Context, remaining int) (time.Time, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok || remaining <= 1 {
+		return time.Time{}, false
+	}
+	left := time.Until(deadline)
+	share := left / time.Duration(remaining)
+	const floor = 2 * time.Second
+	if share < floor {
+		if left < floor {
+			return deadline, true
+		}
+		share = floor
+	}
+	return time.Now().Add(share), true
+}
+
+// lookup returns the host:port addresses to try for address, in order
+func (d *dialer) lookup(ctx context.Context, address string) ([]string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if overrides, ok := d.resolve[strings.ToLower(address)]; ok {
+		candidates := make([]string, 0, len(overrides))
+		for _, override := range overrides {
+			if _, _, err := net.SplitHostPort(override); err != nil {
+				override = net.JoinHostPort(override, port)
+			}
+			candidates = append(candidates, override)
+		}
+		return candidates, nil
+	}
+
+	if net.ParseIP(host) != nil {
+		return []string{address}, nil
+	}
+	// LookupHost reports no httptrace events of its own, unlike the lookups of net.Dialer
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.DNSStart != nil {
+		trace.DNSStart(httptrace.DNSStartInfo{Host: host})
+	}
+	resolver := d.resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	ips, err := resolver.LookupHost(ctx, host)
+	if trace != nil && trace.DNSDone != nil {
+		trace.DNSDone(httptrace.DNSDoneInfo{Err: err})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	candidates := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		candidates = append(candidates, net.JoinHostPort(ip, port))
+	}
+	return candidates, nil
+}
@@ -0,0 +1,308 @@
+package webreq
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// DigestAuth authenticates with HTTP Digest authentication (RFC 7616).
+//
+// The first request is sent without credentials; the 401 challenge is parsed
+// and the request is replayed, Data included, with a digest response. The
+// challenge is then reused for later requests with an increasing nonce count
+// until the server rejects the nonce as stale. MD5, SHA-256 and their -sess
+// variants are supported, preferring SHA-256 when the server offers both.
+type DigestAuth struct {
+	Username string
+	Password string
+	// PasswordSource resolves the password when a challenge is answered,
+	// used when Password is empty
+	PasswordSource SecretSource
+	// PreferAuthInt selects qop=auth-int, which also protects the body, when
+	// the server offers it together with qop=auth
+	PreferAuthInt bool
+
+	mu        sync.Mutex
+	challenge *digestChallenge
+	count     uint32
+}
+
+// digestChallenge is a parsed Digest WWW-Authenticate challenge
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       []string
+	userhash  bool
+}
+
+// NewDigestAuth creates a DigestAuth for the given credentials
+func NewDigestAuth(username string, password string) *DigestAuth {
+	return &DigestAuth{Username: username, Password: password}
+}
+
+// NewDigestAuthFrom creates a DigestAuth resolving the password from source
+func NewDigestAuthFrom(username string, password SecretSource) *DigestAuth {
+	return &DigestAuth{Username: username, PasswordSource: password}
+}
+
+// Authenticate answers the last challenge, if any, with the next nonce count
+func (auth *DigestAuth) Authenticate(ctx context.Context, req *http.Request) error {
+	auth.mu.Lock()
+	challenge := auth.challenge
+	auth.count++
+	count := auth.count
+	auth.mu.Unlock()
+
+	if challenge == nil {
+		return nil
+	}
+	password, err := resolveSecret(ctx, auth.Password, auth.PasswordSource)
+	if err != nil {
+		return err
+	}
+	cnonce, err := randomCnonce()
+	if err != nil {
+		return err
+	}
+
+	qop := challenge.selectQop(auth.PreferAuthInt)
+	var body []byte
+	if qop == "auth-int" && req.GetBody != nil {
+		reader, err := req.GetBody()
+		if err != nil {
+			return err
+		}
+		body, err = io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	header, err := challenge.authorization(auth.Username, password, req.Method, req.URL.RequestURI(), qop, count, cnonce, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", header)
+	return nil
+}
+
+// Invalidate takes the new challenge of a 401 response and asks for a retry
+func (auth *DigestAuth) Invalidate(ctx context.Context, response *http.Response) bool {
+	challenge := parseDigestChallenges(response.Header.Values("WWW-Authenticate"))
+	if challenge == nil {
+		return false
+	}
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+	auth.challenge = challenge
+	auth.count = 0
+	return true
+}
+
+// selectQop returns the qop to answer with, or "" for RFC 2069 challenges
+func (challenge *digestChallenge) selectQop(preferAuthInt bool) string {
+	hasAuth, hasAuthInt := false, false
+	for _, qop := range challenge.qop {
+		switch qop {
+		case "auth":
+			hasAuth = true
+		case "auth-int":
+			hasAuthInt = true
+		}
+	}
+	if hasAuthInt && (preferAuthInt || !hasAuth) {
+		return "auth-int"
+	}
+	if hasAuth {
+		return "auth"
+	}
+	return ""
+}
+
+// authorization computes the Authorization header answering the challenge
+func (challenge *digestChallenge) authorization(username string, password string, method string, uri string, qop string, count uint32, cnonce string, body []byte) (string, error) {
+	algorithm := strings.ToUpper(challenge.algorithm)
+	if algorithm == "" {
+		algorithm = "MD5"
+	}
+	var newHash func() hash.Hash
+	switch strings.TrimSuffix(algorithm, "-SESS") {
+	case "MD5":
+		newHash = md5.New
+	case "SHA-256":
+		newHash = sha256.New
+	default:
+		return "", fmt.Errorf("unsupported digest algorithm %q", challenge.algorithm)
+	}
+	digest := func(parts ...string) string {
+		h := newHash()
+		h.Write([]byte(strings.Join(parts, ":")))
+		return hex.EncodeToString(h.Sum(nil))
+	}
+
+	ha1 := digest(username, challenge.realm, password)
+	if strings.HasSuffix(algorithm, "-SESS") {
+		ha1 = digest(ha1, challenge.nonce, cnonce)
+	}
+	ha2 := digest(method, uri)
+	if qop == "auth-int" {
+		ha2 = digest(method, uri, digest(string(body)))
+	}
+
+	nc := fmt.Sprintf("%08x", count)
+	var response string
+	if qop == "" {
+		response = digest(ha1, challenge.nonce, ha2)
+	} else {
+		response = digest(ha1, challenge.nonce, nc, cnonce, qop, ha2)
+	}
+
+	if challenge.userhash {
+		username = digest(username, challenge.realm)
+	}
+	// echo the algorithm as the server spelled it, "MD5-sess" rather than "MD5-SESS"
+	if challenge.algorithm != "" {
+		algorithm = challenge.algorithm
+	}
+	fields := []string{
+		"username=" + quoteDigest(username),
+		"realm=" + quoteDigest(challenge.realm),
+		"uri=" + quoteDigest(uri),
+		"algorithm=" + algorithm,
+		"nonce=" + quoteDigest(challenge.nonce),
+	}
+	if qop != "" {
+		fields = append(fields, "nc="+nc, "cnonce="+quoteDigest(cnonce), "qop="+qop)
+	}
+	fields = append(fields, "response="+quoteDigest(response))
+	if challenge.opaque != "" {
+		fields = append(fields, "opaque="+quoteDigest(challenge.opaque))
+	}
+	if challenge.userhash {
+		fields = append(fields, "userhash=true")
+	}
+	return "Digest " + strings.Join(fields, ", "), nil
+}
+
+// parseDigestChallenges returns the strongest supported Digest challenge
+func parseDigestChallenges(values []string) *digestChallenge {
+	var best *digestChallenge
+	for _, value := range values {
+		for _, params := range digestChallengeParams(value) {
+			challenge := &digestChallenge{
+				realm:     params["realm"],
+				nonce:     params["nonce"],
+				opaque:    params["opaque"],
+				algorithm: params["algorithm"],
+				userhash:  strings.EqualFold(params["userhash"], "true"),
+			}
+			for _, qop := range strings.Split(params["qop"], ",") {
+				if qop = strings.ToLower(strings.TrimSpace(qop)); qop != "" {
+					challenge.qop = append(challenge.qop, qop)
+				}
+			}
+			rank := digestAlgorithmRank(challenge.algorithm)
+			if challenge.nonce == "" || rank == 0 {
+				continue
+			}
+			if best == nil || rank > digestAlgorithmRank(best.algorithm) {
+				best = challenge
+			}
+		}
+	}
+	return best
+}
+
+// digestAlgorithmRank orders supported algorithms, zero means unsupported
+func digestAlgorithmRank(algorithm string) int {
+	switch strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS") {
+	case "", "MD5":
+		return 1
+	case "SHA-256":
+		return 2
+	}
+	return 0
+}
+
+// digestChallengeParams splits a WWW-Authenticate value into the parameters
+// of each Digest challenge it contains, skipping other schemes
+func digestChallengeParams(value string) []map[string]string {
+	var challenges []map[string]string
+	var current map[string]string
+	rest := value
+	for {
+		rest = strings.TrimLeft(rest, " \t,")
+		if rest == "" {
+			break
+		}
+		end := strings.IndexAny(rest, " \t=,")
+		if end < 0 {
+			end = len(rest)
+		}
+		token := rest[:end]
+		rest = strings.TrimLeft(rest[end:], " \t")
+
+		if !strings.HasPrefix(rest, "=") {
+			// a new auth scheme starts
+			current = nil
+			if strings.EqualFold(token, "Digest") {
+				current = map[string]string{}
+				challenges = append(challenges, current)
+			}
+			continue
+		}
+
+		rest = strings.TrimLeft(rest[1:], " \t")
+		var paramValue string
+		if strings.HasPrefix(rest, `"`) {
+			var builder strings.Builder
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				builder.WriteByte(rest[i])
+			}
+			paramValue = builder.String()
+			if i < len(rest) {
+				i++
+			}
+			rest = rest[i:]
+		} else {
+			end := strings.IndexAny(rest, " \t,")
+			if end < 0 {
+				end = len(rest)
+			}
+			paramValue = rest[:end]
+			rest = rest[end:]
+		}
+		if current != nil {
+			current[strings.ToLower(token)] = paramValue
+		}
+	}
+	return challenges
+}
+
+func quoteDigest(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+func randomCnonce() (string, error) {
+	buffer := make([]byte, 16)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buffer), nil
+}
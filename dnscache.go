@@ -0,0 +1,238 @@
+package webreq
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultDNSCacheTTL         = time.Minute
+	DefaultDNSCacheNegativeTTL = 5 * time.Second
+	DefaultDNSCacheStaleTTL    = 5 * time.Minute
+	// dnsLookupTimeout bounds upstream queries, which are shared between
+	// callers and so run on none of their contexts
+	dnsLookupTimeout = 10 * time.Second
+	// dnsSweepInterval is how often entries past their StaleTTL are dropped
+	dnsSweepInterval = time.Minute
+)
+
+// TTLResolver is implemented by resolvers that know the TTL of the records
+// they return. The system resolver hides TTLs, so CachingResolver falls back
+// to its configured TTL for upstreams that don't implement it.
+type TTLResolver interface {
+	LookupHostTTL(ctx context.Context, host string) ([]string, time.Duration, error)
+}
+
+// CachingResolver is an in-process DNS cache for a Client's dialer.
+//
+// Answers are kept for their TTL (capped at TTL) and "no such host" answers
+// for NegativeTTL. Entries close to expiry are refreshed in the background
+// while the cached answer is served, and when the upstream fails an expired
+// answer is served for up to StaleTTL, after which the entry is dropped. Each lookup rotates the address list so
+// connections are spread over every A/AAAA record.
+type CachingResolver struct {
+	Upstream    Resolver
+	TTL         time.Duration
+	NegativeTTL time.Duration
+	StaleTTL    time.Duration
+
+	mu       sync.Mutex
+	entries  map[string]*dnsEntry
+	inflight map[string]*dnsLookup
+	swept    time.Time
+	now      func() time.Time
+}
+
+type dnsEntry struct {
+	addrs      []string
+	err        error
+	expires    time.Time
+	ttl        time.Duration
+	next       int
+	refreshing bool
+}
+
+// dnsLookup is an upstream lookup shared by concurrent callers
+type dnsLookup struct {
+	done  chan struct{}
+	addrs []string
+	ttl   time.Duration
+	err   error
+}
+
+// NewCachingResolver creates a CachingResolver in front of upstream, or the system resolver when nil
+func NewCachingResolver(upstream Resolver) *CachingResolver {
+	if upstream == nil {
+		upstream = net.DefaultResolver
+	}
+	return &CachingResolver{
+		Upstream:    upstream,
+		TTL:         DefaultDNSCacheTTL,
+		NegativeTTL: DefaultDNSCacheNegativeTTL,
+		StaleTTL:    DefaultDNSCacheStaleTTL,
+		entries:     make(map[string]*dnsEntry),
+		inflight:    make(map[string]*dnsLookup),
+		now:         time.Now,
+	}
+}
+
+// LookupHost returns the cached addresses of host, looking them up when needed
+func (resolver *CachingResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	resolver.mu.Lock()
+	if resolver.entries == nil {
+		resolver.entries = make(map[string]*dnsEntry)
+		resolver.inflight = make(map[string]*dnsLookup)
+	}
+	if resolver.now == nil {
+		resolver.now = time.Now
+	}
+	if resolver.Upstream == nil {
+		resolver.Upstream = net.DefaultResolver
+	}
+	now := resolver.now()
+	entry := resolver.entries[host]
+	if entry != nil && now.Before(entry.expires) {
+		if entry.err != nil {
+			resolver.mu.Unlock()
+			return nil, entry.err
+		}
+		// refresh ahead during the last tenth of the TTL
+		if !entry.refreshing && now.After(entry.expires.Add(-entry.ttl/10)) {
+			entry.refreshing = true
+			go resolver.refresh(host)
+		}
+		addrs := entry.rotate()
+		resolver.mu.Unlock()
+		return addrs, nil
+	}
+	resolver.mu.Unlock()
+
+	addrs, ttl, err := resolver.lookup(ctx, host)
+
+	resolver.mu.Lock()
+	defer resolver.mu.Unlock()
+	if err != nil {
+		entry = resolver.entries[host]
+		if entry != nil && entry.err == nil && resolver.now().Before(entry.expires.Add(resolver.StaleTTL)) {
+			return entry.rotate(), nil
+		}
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			resolver.store(host, nil, err, resolver.NegativeTTL)
+		}
+		return nil, err
+	}
+	return resolver.store(host, addrs, nil, ttl).rotate(), nil
+}
+
+// Flush drops every cached answer
+func (resolver *CachingResolver) Flush() {
+	resolver.mu.Lock()
+	defer resolver.mu.Unlock()
+	resolver.entries = make(map[string]*dnsEntry)
+}
+
+// refresh replaces a live entry in the background, keeping it when the upstream fails
+func (resolver *CachingResolver) refresh(host string) {
+	addrs, ttl, err := resolver.lookup(context.Background(), host)
+
+	resolver.mu.Lock()
+	defer resolver.mu.Unlock()
+	if err != nil {
+		if entry := resolver.entries[host]; entry != nil {
+			entry.refreshing = false
+		}
+		return
+	}
+	resolver.store(host, addrs, nil, ttl)
+}
+
+// lookup queries the upstream, sharing one query between concurrent callers
+// of the same host. The query runs on its own context, so each caller only
+// gives up on its own ctx and never fails because another caller did.
+func (resolver *CachingResolver) lookup(ctx context.Context, host string) ([]string, time.Duration, error) {
+	resolver.mu.Lock()
+	call, ok := resolver.inflight[host]
+	if !ok {
+		call = &dnsLookup{done: make(chan struct{})}
+		resolver.inflight[host] = call
+		go resolver.query(host, call)
+	}
+	resolver.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.addrs, call.ttl, call.err
+	case <-ctx.Done():
+		return nil, 0, ctx.Err()
+	}
+}
+
+// query runs a shared upstream lookup and publishes its answer to call
+func (resolver *CachingResolver) query(host string, call *dnsLookup) {
+	ctx, cancel := context.WithTimeout(context.Background(), dnsLookupTimeout)
+	defer cancel()
+	if ttlResolver, ok := resolver.Upstream.(TTLResolver); ok {
+		call.addrs, call.ttl, call.err = ttlResolver.LookupHostTTL(ctx, host)
+	} else {
+		call.addrs, call.err = resolver.Upstream.LookupHost(ctx, host)
+	}
+	if call.ttl <= 0 || call.ttl > resolver.TTL {
+		call.ttl = resolver.TTL
+	}
+
+	resolver.mu.Lock()
+	delete(resolver.inflight, host)
+	resolver.mu.Unlock()
+	close(call.done)
+}
+
+// store caches an answer; callers hold resolver.mu
+func (resolver *CachingResolver) store(host string, addrs []string, err error, ttl time.Duration) *dnsEntry {
+	now := resolver.now()
+	if now.Sub(resolver.swept) >= dnsSweepInterval {
+		resolver.sweep(now)
+	}
+	entry := &dnsEntry{
+		addrs:   addrs,
+		err:     err,
+		ttl:     ttl,
+		expires: now.Add(ttl),
+	}
+	if previous := resolver.entries[host]; previous != nil {
+		entry.next = previous.next
+	}
+	resolver.entries[host] = entry
+	return entry
+}
+
+// sweep drops the entries that can no longer be served, even as stale
+// answers, so hosts looked up once don't stay cached forever; callers hold
+// resolver.mu
+func (resolver *CachingResolver) sweep(now time.Time) {
+	resolver.swept = now
+	for host, entry := range resolver.entries {
+		expires := entry.expires
+		if entry.err == nil {
+			expires = expires.Add(resolver.StaleTTL)
+		}
+		if !now.Before(expires) && !entry.refreshing {
+			delete(resolver.entries, host)
+		}
+	}
+}
+
+// rotate returns the addresses starting at the next one in round-robin order
+func (entry *dnsEntry) rotate() []string {
+	if len(entry.addrs) == 0 {
+		return nil
+	}
+	start := entry.next % len(entry.addrs)
+	entry.next++
+	rotated := make([]string, 0, len(entry.addrs))
+	rotated = append(rotated, entry.addrs[start:]...)
+	return append(rotated, entry.addrs[:start]...)
+}
@@ -0,0 +1,193 @@
+package webreq
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrEgressDenied is wrapped by every error caused by an EgressPolicy
+var ErrEgressDenied = errors.New("egress denied")
+
+// DefaultDeniedNetworks are the ranges NewEgressPolicy blocks: loopback,
+// private, link-local (including cloud metadata at 169.254.169.254),
+// carrier-grade NAT, benchmarking, multicast, reserved and their IPv6
+// counterparts.
+var DefaultDeniedNetworks = []string{
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"64:ff9b::/96",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+}
+
+// EgressPolicy restricts where a Client may connect. It is checked when the
+// connection is dialled, after DNS resolution, so a hostname that resolves or
+// rebinds to a denied address is refused, and every redirect hop is dialled
+// and checked the same way.
+//
+// An address is refused when it is in DeniedNetworks, or when AllowedNetworks
+// is set and the address is in none of them. Denied networks win, so carving
+// an internal service out of the defaults means building DeniedNetworks
+// without its range.
+//
+// When the Client uses a proxy the policy applies to the connection to the
+// proxy, which then has to filter targets itself. HTTP_PROXY and friends are
+// ignored by Clients with a policy unless a ProxyConfig is set explicitly.
+type EgressPolicy struct {
+	AllowedNetworks []*net.IPNet
+	DeniedNetworks  []*net.IPNet
+	AllowedPorts    []int    // empty allows any port
+	AllowedSchemes  []string // empty allows http and https
+}
+
+// NewEgressPolicy creates an EgressPolicy denying DefaultDeniedNetworks
+func NewEgressPolicy() *EgressPolicy {
+	policy := &EgressPolicy{}
+	for _, cidr := range DefaultDeniedNetworks {
+		_, network, _ := net.ParseCIDR(cidr)
+		policy.DeniedNetworks = append(policy.DeniedNetworks, network)
+	}
+	return policy
+}
+
+// Allow restricts connections to the given CIDRs or IP addresses
+func (policy *EgressPolicy) Allow(cidrs ...string) error {
+	networks, err := parseNetworks(cidrs)
+	if err != nil {
+		return err
+	}
+	policy.AllowedNetworks = append(policy.AllowedNetworks, networks...)
+	return nil
+}
+
+// Deny refuses connections to the given CIDRs or IP addresses
+func (policy *EgressPolicy) Deny(cidrs ...string) error {
+	networks, err := parseNetworks(cidrs)
+	if err != nil {
+		return err
+	}
+	policy.DeniedNetworks = append(policy.DeniedNetworks, networks...)
+	return nil
+}
+
+// AllowPorts restricts connections to the given ports
+func (policy *EgressPolicy) AllowPorts(ports ...int) *EgressPolicy {
+	policy.AllowedPorts = append(policy.AllowedPorts, ports...)
+	return policy
+}
+
+// AllowSchemes restricts requests to the given URL schemes
+func (policy *EgressPolicy) AllowSchemes(schemes ...string) *EgressPolicy {
+	policy.AllowedSchemes = append(policy.AllowedSchemes, schemes...)
+	return policy
+}
+
+// checkRequest validates the scheme and port of a request or redirect target
+func (policy *EgressPolicy) checkRequest(req *http.Request) error {
+	allowed := policy.AllowedSchemes
+	if len(allowed) == 0 {
+		allowed = []string{"http", "https"}
+	}
+	if !containsFold(allowed, req.URL.Scheme) {
+		return fmt.Errorf("%w: scheme %q", ErrEgressDenied, req.URL.Scheme)
+	}
+	return policy.checkPort(portOf(req))
+}
+
+// checkAddress validates a resolved ip:port before it is dialled
+func (policy *EgressPolicy) checkAddress(address string) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("%w: %s is not an ip address", ErrEgressDenied, host)
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	for _, network := range policy.DeniedNetworks {
+		if network.Contains(ip) {
+			return fmt.Errorf("%w: %s is in %s", ErrEgressDenied, ip, network)
+		}
+	}
+	if len(policy.AllowedNetworks) > 0 && !containsIP(policy.AllowedNetworks, ip) {
+		return fmt.Errorf("%w: %s is not in an allowed network", ErrEgressDenied, ip)
+	}
+	return policy.checkPort(port)
+}
+
+func (policy *EgressPolicy) checkPort(port string) error {
+	if len(policy.AllowedPorts) == 0 {
+		return nil
+	}
+	number, err := strconv.Atoi(port)
+	if err == nil {
+		for _, allowed := range policy.AllowedPorts {
+			if allowed == number {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: port %s", ErrEgressDenied, port)
+}
+
+// parseNetworks parses CIDRs, treating bare IP addresses as single hosts
+func parseNetworks(cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip address %q", cidr)
+			}
+			if v4 := ip.To4(); v4 != nil {
+				networks = append(networks, &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)})
+			} else {
+				networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)})
+			}
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr %q: %w", cidr, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, candidate := range values {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
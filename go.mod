@@ -1,3 +1,12 @@
 module github.com/tonnytg/webreq
 
 go 1.18
+
+require (
+	github.com/klauspost/compress v1.17.0
+	golang.org/x/net v0.17.0
+	gopkg.in/yaml.v3 v3.0.1
+	software.sslmate.com/src/go-pkcs12 v0.2.0
+)
+
+require golang.org/x/crypto v0.14.0 // indirect
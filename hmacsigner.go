@@ -0,0 +1,385 @@
+package webreq
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HMACEncodingHex    = "hex"
+	HMACEncodingBase64 = "base64"
+	// DefaultHMACTolerance is how far a signed timestamp may be from the
+	// receiver's clock
+	DefaultHMACTolerance = 5 * time.Minute
+)
+
+// HMACSigner signs requests with an HMAC of selected parts of the request,
+// the scheme used by most webhook providers, and verifies such requests on
+// the receiving side.
+//
+// Payload is a template of the signed bytes, and Format a template of the
+// signature header value. Templates may use these placeholders:
+//
+//	{timestamp}    unix time in seconds
+//	{method}       request method
+//	{path}         path and query of the request
+//	{host}         host of the request
+//	{body}         request body
+//	{header:Name}  value of the named header
+//	{signature}    the encoded HMAC, in Format only
+//
+// The timestamp is sent in Format or in TimestampHeader.
+type HMACSigner struct {
+	Secret []byte
+	// SecretSource resolves the secret when signing or verifying, used when
+	// Secret is empty
+	SecretSource SecretSource
+	// Hash is the HMAC hash function, sha256.New when nil
+	Hash func() hash.Hash
+	// Payload is the template of the signed bytes
+	Payload string
+	// Header carries the signature, formatted by Format
+	Header string
+	// Format of the Header value, "{signature}" when empty
+	Format string
+	// TimestampHeader carries the timestamp when Format does not
+	TimestampHeader string
+	// Encoding of the signature, HMACEncodingHex or HMACEncodingBase64
+	Encoding string
+	// Tolerance is the largest clock difference Verify accepts for the
+	// timestamp, zero disables the check
+	Tolerance time.Duration
+
+	now func() time.Time
+}
+
+// NewHMACSigner creates an HMACSigner signing "{timestamp}.{body}" with
+// HMAC-SHA256 into hex X-Signature and X-Timestamp headers
+func NewHMACSigner(secret []byte) *HMACSigner {
+	return &HMACSigner{
+		Secret:          secret,
+		Payload:         "{timestamp}.{body}",
+		Header:          "X-Signature",
+		TimestampHeader: "X-Timestamp",
+		Encoding:        HMACEncodingHex,
+		Tolerance:       DefaultHMACTolerance,
+	}
+}
+
+// GitHubHMAC signs and verifies GitHub style webhooks (X-Hub-Signature-256),
+// which sign the body alone and carry no timestamp
+func GitHubHMAC(secret []byte) *HMACSigner {
+	return &HMACSigner{
+		Secret:   secret,
+		Payload:  "{body}",
+		Header:   "X-Hub-Signature-256",
+		Format:   "sha256={signature}",
+		Encoding: HMACEncodingHex,
+	}
+}
+
+// StripeHMAC signs and verifies Stripe style webhooks (Stripe-Signature)
+func StripeHMAC(secret []byte) *HMACSigner {
+	return &HMACSigner{
+		Secret:    secret,
+		Payload:   "{timestamp}.{body}",
+		Header:    "Stripe-Signature",
+		Format:    "t={timestamp},v1={signature}",
+		Encoding:  HMACEncodingHex,
+		Tolerance: DefaultHMACTolerance,
+	}
+}
+
+// SlackHMAC signs and verifies Slack style requests (X-Slack-Signature)
+func SlackHMAC(secret []byte) *HMACSigner {
+	return &HMACSigner{
+		Secret:          secret,
+		Payload:         "v0:{timestamp}:{body}",
+		Header:          "X-Slack-Signature",
+		Format:          "v0={signature}",
+		TimestampHeader: "X-Slack-Request-Timestamp",
+		Encoding:        HMACEncodingHex,
+		Tolerance:       DefaultHMACTolerance,
+	}
+}
+
+// SetSecretSource resolves the secret from source instead of Secret
+func (signer *HMACSigner) SetSecretSource(source SecretSource) *HMACSigner {
+	signer.Secret = nil
+	signer.SecretSource = source
+	return signer
+}
+
+// SetHash sets the HMAC hash function, such as sha512.New
+func (signer *HMACSigner) SetHash(hash func() hash.Hash) *HMACSigner {
+	signer.Hash = hash
+	return signer
+}
+
+// SetPayload sets the template of the signed bytes
+func (signer *HMACSigner) SetPayload(payload string) *HMACSigner {
+	signer.Payload = payload
+	return signer
+}
+
+// SetHeader sets the signature header and the template of its value
+func (signer *HMACSigner) SetHeader(name string, format string) *HMACSigner {
+	signer.Header = name
+	signer.Format = format
+	return signer
+}
+
+// SetTimestampHeader sets the header carrying the timestamp
+func (signer *HMACSigner) SetTimestampHeader(name string) *HMACSigner {
+	signer.TimestampHeader = name
+	return signer
+}
+
+// SetEncoding sets the signature encoding, HMACEncodingHex or HMACEncodingBase64
+func (signer *HMACSigner) SetEncoding(encoding string) *HMACSigner {
+	signer.Encoding = encoding
+	return signer
+}
+
+// SetTolerance sets the largest clock difference accepted by Verify
+func (signer *HMACSigner) SetTolerance(tolerance time.Duration) *HMACSigner {
+	signer.Tolerance = tolerance
+	return signer
+}
+
+// Authenticate signs req, adding the signature and timestamp headers
+func (signer *HMACSigner) Authenticate(ctx context.Context, req *http.Request) error {
+	if signer.Header == "" {
+		return errors.New("hmac signer has no signature header")
+	}
+	body, err := requestBody(req)
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(signer.time().Unix(), 10)
+	format := signer.format()
+	if strings.Contains(signer.Payload, "{timestamp}") && !strings.Contains(format, "{timestamp}") && signer.TimestampHeader == "" {
+		return errors.New("hmac payload signs a timestamp that is not sent")
+	}
+
+	mac, err := signer.mac(req, body, timestamp)
+	if err != nil {
+		return err
+	}
+	parts, err := parseHMACTemplate(format)
+	if err != nil {
+		return err
+	}
+	var value strings.Builder
+	for _, part := range parts {
+		switch part.placeholder {
+		case "":
+			value.WriteString(part.literal)
+		case "signature":
+			value.WriteString(signer.encode(mac))
+		case "timestamp":
+			value.WriteString(timestamp)
+		default:
+			return fmt.Errorf("unsupported placeholder {%s} in hmac header format", part.placeholder)
+		}
+	}
+	if signer.TimestampHeader != "" {
+		req.Header.Set(signer.TimestampHeader, timestamp)
+	}
+	req.Header.Set(signer.Header, value.String())
+	return nil
+}
+
+// Verify checks the signature of a received request whose body, already read
+// by the caller, is body. Errors wrap ErrSignatureInvalid.
+func (signer *HMACSigner) Verify(req *http.Request, body []byte) error {
+	values, err := signer.parseHeader(req.Header.Get(signer.Header))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSignatureInvalid, err)
+	}
+	timestamp := values["timestamp"]
+	if timestamp == "" && signer.TimestampHeader != "" {
+		timestamp = req.Header.Get(signer.TimestampHeader)
+	}
+	if strings.Contains(signer.Payload, "{timestamp}") || timestamp != "" {
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: invalid timestamp %q", ErrSignatureInvalid, timestamp)
+		}
+		skew := signer.time().Sub(time.Unix(seconds, 0))
+		if signer.Tolerance > 0 && (skew > signer.Tolerance || skew < -signer.Tolerance) {
+			return fmt.Errorf("%w: timestamp is %v away from the current time", ErrSignatureInvalid, skew.Round(time.Second))
+		}
+	}
+
+	provided, err := signer.decode(values["signature"])
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSignatureInvalid, err)
+	}
+	expected, err := signer.mac(req, body, timestamp)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(provided, expected) {
+		return fmt.Errorf("%w: signature does not match", ErrSignatureInvalid)
+	}
+	return nil
+}
+
+// mac computes the HMAC of the payload of req
+func (signer *HMACSigner) mac(req *http.Request, body []byte, timestamp string) ([]byte, error) {
+	secret := signer.Secret
+	if len(secret) == 0 && signer.SecretSource != nil {
+		value, err := signer.SecretSource.Secret(req.Context())
+		if err != nil {
+			return nil, err
+		}
+		secret = []byte(value)
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("hmac signer has no secret")
+	}
+	parts, err := parseHMACTemplate(signer.Payload)
+	if err != nil {
+		return nil, err
+	}
+	newHash := signer.Hash
+	if newHash == nil {
+		newHash = sha256.New
+	}
+	mac := hmac.New(newHash, secret)
+	for _, part := range parts {
+		switch name := part.placeholder; {
+		case name == "":
+			mac.Write([]byte(part.literal))
+		case name == "timestamp":
+			mac.Write([]byte(timestamp))
+		case name == "method":
+			mac.Write([]byte(req.Method))
+		case name == "path":
+			mac.Write([]byte(req.URL.RequestURI()))
+		case name == "host":
+			host := req.Host
+			if host == "" {
+				host = req.URL.Host
+			}
+			mac.Write([]byte(host))
+		case name == "body":
+			mac.Write(body)
+		case strings.HasPrefix(name, "header:"):
+			mac.Write([]byte(req.Header.Get(strings.TrimPrefix(name, "header:"))))
+		default:
+			return nil, fmt.Errorf("unsupported placeholder {%s} in hmac payload", name)
+		}
+	}
+	return mac.Sum(nil), nil
+}
+
+// parseHeader extracts the placeholders of Format from a header value
+func (signer *HMACSigner) parseHeader(value string) (map[string]string, error) {
+	if value == "" {
+		return nil, fmt.Errorf("%s header is missing", signer.Header)
+	}
+	parts, err := parseHMACTemplate(signer.format())
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	var pattern strings.Builder
+	for _, part := range parts {
+		switch part.placeholder {
+		case "":
+			pattern.WriteString(regexp.QuoteMeta(part.literal))
+		case "signature":
+			pattern.WriteString(`([A-Za-z0-9+/=_-]+)`)
+		case "timestamp":
+			pattern.WriteString(`([0-9]+)`)
+		default:
+			return nil, fmt.Errorf("unsupported placeholder {%s} in hmac header format", part.placeholder)
+		}
+		if part.placeholder != "" {
+			names = append(names, part.placeholder)
+		}
+	}
+	match := regexp.MustCompile(pattern.String()).FindStringSubmatch(value)
+	if match == nil {
+		return nil, fmt.Errorf("%s header does not match %q", signer.Header, signer.format())
+	}
+	values := map[string]string{}
+	for i, name := range names {
+		values[name] = match[i+1]
+	}
+	return values, nil
+}
+
+func (signer *HMACSigner) format() string {
+	if signer.Format != "" {
+		return signer.Format
+	}
+	return "{signature}"
+}
+
+func (signer *HMACSigner) encode(mac []byte) string {
+	if signer.Encoding == HMACEncodingBase64 {
+		return base64.StdEncoding.EncodeToString(mac)
+	}
+	return hex.EncodeToString(mac)
+}
+
+func (signer *HMACSigner) decode(signature string) ([]byte, error) {
+	if signer.Encoding == HMACEncodingBase64 {
+		decoded, err := base64.StdEncoding.DecodeString(signature)
+		if err != nil {
+			decoded, err = base64.URLEncoding.DecodeString(signature)
+		}
+		return decoded, err
+	}
+	return hex.DecodeString(strings.ToLower(signature))
+}
+
+func (signer *HMACSigner) time() time.Time {
+	if signer.now != nil {
+		return signer.now()
+	}
+	return time.Now()
+}
+
+// hmacTemplatePart is a literal or a {placeholder} of an HMACSigner template
+type hmacTemplatePart struct {
+	literal     string
+	placeholder string
+}
+
+// parseHMACTemplate splits a template into literals and placeholders
+func parseHMACTemplate(template string) ([]hmacTemplatePart, error) {
+	var parts []hmacTemplatePart
+	rest := template
+	for rest != "" {
+		start := strings.Index(rest, "{")
+		if start < 0 {
+			parts = append(parts, hmacTemplatePart{literal: rest})
+			break
+		}
+		end := strings.Index(rest[start:], "}")
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated placeholder in %q", template)
+		}
+		if start > 0 {
+			parts = append(parts, hmacTemplatePart{literal: rest[:start]})
+		}
+		parts = append(parts, hmacTemplatePart{placeholder: rest[start+1 : start+end]})
+		rest = rest[start+end+1:]
+	}
+	return parts, nil
+}
@@ -0,0 +1,760 @@
+package webreq
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Algorithms of HTTP message signatures (RFC 9421 section 3.3)
+const (
+	SignatureHMACSHA256  = "hmac-sha256"
+	SignatureEd25519     = "ed25519"
+	SignatureECDSAP256   = "ecdsa-p256-sha256"
+	SignatureRSAPSS      = "rsa-pss-sha512"
+	SignatureRSAPKCS1v15 = "rsa-v1_5-sha256"
+)
+
+// Algorithms of Content-Digest and Repr-Digest fields (RFC 9530)
+const (
+	DigestSHA256 = "sha-256"
+	DigestSHA512 = "sha-512"
+)
+
+const (
+	// DefaultSignatureLabel names the signatures created by a MessageSigner
+	DefaultSignatureLabel = "sig1"
+	// signatureClockSkew is how far in the future a created time is accepted
+	signatureClockSkew = time.Minute
+)
+
+var (
+	ErrSignatureInvalid = errors.New("http message signature invalid")
+	ErrDigestMismatch   = errors.New("content digest mismatch")
+)
+
+// SignatureKey is a key of HTTP message signatures. Key holds the shared
+// secret as []byte for hmac-sha256, and otherwise an ed25519, *ecdsa or *rsa
+// private key for signing, or the matching public key for verifying.
+type SignatureKey struct {
+	ID        string // sent as the keyid parameter
+	Algorithm string
+	Key       interface{}
+	// KeySource resolves the key when signing or verifying, used when Key is
+	// nil. It returns the shared secret for hmac-sha256, and otherwise a PEM
+	// encoded PKCS#8, PKCS#1 or SEC 1 private key, or for verifying a PKIX or
+	// PKCS#1 public key or a certificate.
+	KeySource SecretSource
+}
+
+// MessageSigner signs requests and responses with HTTP Message Signatures
+// (RFC 9421). Used as an Authenticator it signs each request at send time;
+// SignResponse signs the responses of a server.
+//
+// Covered content-digest or repr-digest fields missing from the message are
+// generated from the body before signing. Components are field names, such
+// as "content-type", derived components, such as "@method", or serialized
+// component identifiers, such as `"@query-param";name="id"`.
+type MessageSigner struct {
+	Key        SignatureKey
+	Label      string
+	Components []string      // covered components, a default set when nil
+	Expires    time.Duration // adds an expires parameter when positive
+	Nonce      bool          // adds a random nonce parameter
+	Tag        string        // application specific tag parameter
+	Digest     string        // algorithm of generated digests, DigestSHA256 by default
+
+	now func() time.Time
+}
+
+// NewMessageSigner creates a MessageSigner labelling its signatures sig1
+func NewMessageSigner(key SignatureKey) *MessageSigner {
+	return &MessageSigner{Key: key, Label: DefaultSignatureLabel, Digest: DigestSHA256}
+}
+
+// SetComponents sets the covered components
+func (signer *MessageSigner) SetComponents(components ...string) *MessageSigner {
+	signer.Components = components
+	return signer
+}
+
+// SetExpires makes signatures expire after d
+func (signer *MessageSigner) SetExpires(d time.Duration) *MessageSigner {
+	signer.Expires = d
+	return signer
+}
+
+// SetTag sets the tag parameter of signatures
+func (signer *MessageSigner) SetTag(tag string) *MessageSigner {
+	signer.Tag = tag
+	return signer
+}
+
+// Authenticate signs req. Without Components it covers @method, @target-uri
+// and, for requests with a body, content-digest and content-type.
+func (signer *MessageSigner) Authenticate(ctx context.Context, req *http.Request) error {
+	body, err := requestBody(req)
+	if err != nil {
+		return err
+	}
+	components := signer.Components
+	if components == nil {
+		components = []string{"@method", "@target-uri"}
+		components = append(components, bodyComponents(req.Header, body)...)
+	}
+	return signer.sign(ctx, signedMessage{request: req, header: req.Header}, components, body)
+}
+
+// SignResponse signs a response with statusCode and body by adding fields to
+// header, usually the Header of an http.ResponseWriter before WriteHeader.
+// Without Components it covers @status and, for responses with a body,
+// content-digest and content-type.
+func (signer *MessageSigner) SignResponse(header http.Header, statusCode int, body []byte) error {
+	return signer.SignResponseWithContext(context.Background(), header, statusCode, body)
+}
+
+// SignResponseWithContext is SignResponse resolving the KeySource with ctx
+func (signer *MessageSigner) SignResponseWithContext(ctx context.Context, header http.Header, statusCode int, body []byte) error {
+	components := signer.Components
+	if components == nil {
+		components = append([]string{"@status"}, bodyComponents(header, body)...)
+	}
+	return signer.sign(ctx, signedMessage{status: statusCode, header: header}, components, body)
+}
+
+// bodyComponents returns the default components covering a message body
+func bodyComponents(header http.Header, body []byte) []string {
+	if len(body) == 0 {
+		return nil
+	}
+	components := []string{"content-digest"}
+	if header.Get("Content-Type") != "" {
+		components = append(components, "content-type")
+	}
+	return components
+}
+
+func (signer *MessageSigner) sign(ctx context.Context, message signedMessage, components []string, body []byte) error {
+	items, err := parseComponents(components)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		name := item.value.(string)
+		if (name == "content-digest" || name == "repr-digest") && message.header.Get(name) == "" {
+			digest, err := ContentDigest(signer.digest(), body)
+			if err != nil {
+				return err
+			}
+			message.header.Set(name, digest)
+		}
+	}
+
+	now := signer.time()
+	params := []sfParam{{name: "created", value: now.Unix()}}
+	if signer.Expires > 0 {
+		params = append(params, sfParam{name: "expires", value: now.Add(signer.Expires).Unix()})
+	}
+	if signer.Nonce {
+		nonce, err := randomToken(16)
+		if err != nil {
+			return err
+		}
+		params = append(params, sfParam{name: "nonce", value: nonce})
+	}
+	if signer.Key.ID != "" {
+		params = append(params, sfParam{name: "keyid", value: signer.Key.ID})
+	}
+	if signer.Tag != "" {
+		params = append(params, sfParam{name: "tag", value: signer.Tag})
+	}
+
+	base, signatureParams, err := signatureBase(message, items, params)
+	if err != nil {
+		return err
+	}
+	key, err := signer.Key.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	signature, err := key.sign(base)
+	if err != nil {
+		return err
+	}
+	label := signer.Label
+	if label == "" {
+		label = DefaultSignatureLabel
+	}
+	message.header.Set("Signature-Input", label+"="+signatureParams)
+	message.header.Set("Signature", label+"="+serializeSFBare(signature))
+	return nil
+}
+
+func (signer *MessageSigner) time() time.Time {
+	if signer.now != nil {
+		return signer.now()
+	}
+	return time.Now()
+}
+
+func (signer *MessageSigner) digest() string {
+	if signer.Digest != "" {
+		return signer.Digest
+	}
+	return DigestSHA256
+}
+
+// MessageVerifier verifies HTTP Message Signatures of requests received by a
+// server, or of responses when set on a Request or Client. Every signature
+// made with one of Keys, looked up by keyid, must verify and at least one
+// must be present. Content-Digest and Repr-Digest fields are checked against
+// the body whenever they are present.
+type MessageVerifier struct {
+	Keys map[string]SignatureKey
+	// Label restricts verification to the signature of that label
+	Label string
+	// RequiredComponents must be covered by the signatures
+	RequiredComponents []string
+	// MaxAge rejects signatures created longer ago, zero accepts any age
+	MaxAge time.Duration
+
+	now func() time.Time
+}
+
+// NewMessageVerifier creates a MessageVerifier trusting keys
+func NewMessageVerifier(keys ...SignatureKey) *MessageVerifier {
+	verifier := &MessageVerifier{Keys: map[string]SignatureKey{}}
+	for _, key := range keys {
+		verifier.AddKey(key)
+	}
+	return verifier
+}
+
+// AddKey trusts key for signatures with its ID as keyid
+func (verifier *MessageVerifier) AddKey(key SignatureKey) *MessageVerifier {
+	if verifier.Keys == nil {
+		verifier.Keys = map[string]SignatureKey{}
+	}
+	verifier.Keys[key.ID] = key
+	return verifier
+}
+
+// SetRequiredComponents sets the components signatures must cover
+func (verifier *MessageVerifier) SetRequiredComponents(components ...string) *MessageVerifier {
+	verifier.RequiredComponents = components
+	return verifier
+}
+
+// SetMaxAge rejects signatures created more than maxAge ago
+func (verifier *MessageVerifier) SetMaxAge(maxAge time.Duration) *MessageVerifier {
+	verifier.MaxAge = maxAge
+	return verifier
+}
+
+// VerifyRequest verifies the signatures of a received request whose body,
+// already read by the caller, is body. Key sources are resolved with the
+// request's context.
+func (verifier *MessageVerifier) VerifyRequest(req *http.Request, body []byte) error {
+	return verifier.verify(req.Context(), signedMessage{request: req, header: req.Header}, body)
+}
+
+// VerifyResponse verifies the signatures of a response whose body is body.
+// Key sources are resolved with the context of the request that got it.
+func (verifier *MessageVerifier) VerifyResponse(response *http.Response, body []byte) error {
+	ctx := context.Background()
+	if response.Request != nil {
+		ctx = response.Request.Context()
+	}
+	return verifier.verify(ctx, signedMessage{status: response.StatusCode, header: response.Header}, body)
+}
+
+func (verifier *MessageVerifier) verify(ctx context.Context, message signedMessage, body []byte) error {
+	required, err := parseComponents(verifier.RequiredComponents)
+	if err != nil {
+		return err
+	}
+	inputs, err := parseSFDictionary(message.header.Values("Signature-Input"))
+	if err != nil {
+		return fmt.Errorf("%w: Signature-Input: %v", ErrSignatureInvalid, err)
+	}
+	signatures, err := parseSFDictionary(message.header.Values("Signature"))
+	if err != nil {
+		return fmt.Errorf("%w: Signature: %v", ErrSignatureInvalid, err)
+	}
+
+	verified := 0
+	for _, input := range inputs {
+		if verifier.Label != "" && input.name != verifier.Label {
+			continue
+		}
+		keyID, _ := input.item.param("keyid").(string)
+		key, ok := verifier.Keys[keyID]
+		if !ok {
+			if verifier.Label != "" {
+				return fmt.Errorf("%w: %s: unknown key %q", ErrSignatureInvalid, input.name, keyID)
+			}
+			continue
+		}
+		key, err := key.resolve(ctx)
+		if err != nil {
+			return fmt.Errorf("%s: key %q: %w", input.name, keyID, err)
+		}
+		if err := verifier.check(message, input, signatures, key, required); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrSignatureInvalid, input.name, err)
+		}
+		verified++
+	}
+	if verified == 0 {
+		return fmt.Errorf("%w: no signature from a known key", ErrSignatureInvalid)
+	}
+	return VerifyContentDigest(message.header, body)
+}
+
+// check verifies one signature
+func (verifier *MessageVerifier) check(message signedMessage, input sfMember, signatures []sfMember, key SignatureKey, required []sfItem) error {
+	if !input.isList {
+		return errors.New("signature input is not an inner list")
+	}
+	var signature []byte
+	for _, member := range signatures {
+		if member.name == input.name {
+			signature, _ = member.item.value.([]byte)
+		}
+	}
+	if signature == nil {
+		return errors.New("signature is missing")
+	}
+	if algorithm, ok := input.item.param("alg").(string); ok && algorithm != key.Algorithm {
+		return fmt.Errorf("algorithm %q does not match the key", algorithm)
+	}
+
+	covered := map[string]bool{}
+	for _, component := range input.list {
+		covered[serializeSFItem(component)] = true
+	}
+	for _, component := range required {
+		if id := serializeSFItem(component); !covered[id] {
+			return fmt.Errorf("component %s is not covered", id)
+		}
+	}
+
+	now := verifier.time()
+	created, hasCreated := input.item.param("created").(int64)
+	if hasCreated && time.Unix(created, 0).After(now.Add(signatureClockSkew)) {
+		return errors.New("signature is created in the future")
+	}
+	if verifier.MaxAge > 0 && (!hasCreated || now.Sub(time.Unix(created, 0)) > verifier.MaxAge) {
+		return errors.New("signature is too old")
+	}
+	if expires, ok := input.item.param("expires").(int64); ok && now.Unix() > expires {
+		return errors.New("signature has expired")
+	}
+
+	base, _, err := signatureBase(message, input.list, input.item.params)
+	if err != nil {
+		return err
+	}
+	return key.verify(base, signature)
+}
+
+func (verifier *MessageVerifier) time() time.Time {
+	if verifier.now != nil {
+		return verifier.now()
+	}
+	return time.Now()
+}
+
+// ContentDigest returns a Content-Digest or Repr-Digest field value for body
+func ContentDigest(algorithm string, body []byte) (string, error) {
+	sum, err := digestSum(algorithm, body)
+	if err != nil {
+		return "", err
+	}
+	return algorithm + "=" + serializeSFBare(sum), nil
+}
+
+// VerifyContentDigest checks the Content-Digest and Repr-Digest fields of
+// header against body. Absent fields are skipped; a field must carry at least
+// one supported algorithm and every supported one must match.
+func VerifyContentDigest(header http.Header, body []byte) error {
+	for _, name := range []string{"Content-Digest", "Repr-Digest"} {
+		values := header.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+		members, err := parseSFDictionary(values)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrDigestMismatch, name, err)
+		}
+		checked := false
+		for _, member := range members {
+			expected, ok := member.item.value.([]byte)
+			if member.isList || !ok {
+				continue
+			}
+			sum, err := digestSum(member.name, body)
+			if err != nil {
+				continue
+			}
+			if !bytes.Equal(sum, expected) {
+				return fmt.Errorf("%w: %s %s", ErrDigestMismatch, name, member.name)
+			}
+			checked = true
+		}
+		if !checked {
+			return fmt.Errorf("%w: %s has no supported algorithm", ErrDigestMismatch, name)
+		}
+	}
+	return nil
+}
+
+func digestSum(algorithm string, body []byte) ([]byte, error) {
+	switch algorithm {
+	case DigestSHA256:
+		sum := sha256.Sum256(body)
+		return sum[:], nil
+	case DigestSHA512:
+		sum := sha512.Sum512(body)
+		return sum[:], nil
+	}
+	return nil, fmt.Errorf("unsupported digest algorithm %q", algorithm)
+}
+
+// signedMessage resolves the components of a request, or of a response when
+// request is nil
+type signedMessage struct {
+	request *http.Request
+	status  int
+	header  http.Header
+}
+
+// parseComponents turns component names or serialized identifiers into items
+func parseComponents(components []string) ([]sfItem, error) {
+	items := make([]sfItem, 0, len(components))
+	for _, component := range components {
+		if !strings.HasPrefix(component, `"`) {
+			items = append(items, sfItem{value: strings.ToLower(component)})
+			continue
+		}
+		item, err := parseSFItem(component)
+		if err != nil {
+			return nil, fmt.Errorf("invalid component %s: %w", component, err)
+		}
+		if _, ok := item.value.(string); !ok {
+			return nil, fmt.Errorf("invalid component %s", component)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// signatureBase builds the signature base (RFC 9421 section 2.5) and returns
+// it with the serialized signature parameters
+func signatureBase(message signedMessage, components []sfItem, params []sfParam) ([]byte, string, error) {
+	var base strings.Builder
+	seen := map[string]bool{}
+	for _, component := range components {
+		id := serializeSFItem(component)
+		if seen[id] {
+			return nil, "", fmt.Errorf("component %s is covered twice", id)
+		}
+		seen[id] = true
+		value, err := message.component(component)
+		if err != nil {
+			return nil, "", err
+		}
+		base.WriteString(id + ": " + value + "\n")
+	}
+	signatureParams := serializeSFInnerList(components, params)
+	base.WriteString(`"@signature-params": ` + signatureParams)
+	return []byte(base.String()), signatureParams, nil
+}
+
+// component returns the value of a covered component
+func (message signedMessage) component(item sfItem) (string, error) {
+	name, ok := item.value.(string)
+	if !ok {
+		return "", errors.New("component identifier is not a string")
+	}
+	for _, param := range item.params {
+		if param.name != "name" || name != "@query-param" {
+			return "", fmt.Errorf("unsupported parameter %q of component %q", param.name, name)
+		}
+	}
+	if strings.HasPrefix(name, "@") {
+		return message.derived(name, item)
+	}
+	if name != strings.ToLower(name) {
+		return "", fmt.Errorf("component %q is not lowercase", name)
+	}
+
+	values := message.header.Values(name)
+	if len(values) == 0 && message.request != nil {
+		// net/http moves these fields out of the header map
+		switch name {
+		case "host":
+			values = []string{message.authority()}
+		case "content-length":
+			if message.request.ContentLength > 0 {
+				values = []string{strconv.FormatInt(message.request.ContentLength, 10)}
+			}
+		}
+	}
+	if len(values) == 0 {
+		return "", fmt.Errorf("covered field %q is missing", name)
+	}
+	trimmed := make([]string, len(values))
+	for i, value := range values {
+		trimmed[i] = strings.TrimSpace(value)
+	}
+	return strings.Join(trimmed, ", "), nil
+}
+
+// derived returns the value of a derived component (RFC 9421 section 2.2)
+func (message signedMessage) derived(name string, item sfItem) (string, error) {
+	if name == "@status" {
+		if message.request != nil {
+			return "", errors.New("component \"@status\" is only available on responses")
+		}
+		return strconv.Itoa(message.status), nil
+	}
+	req := message.request
+	if req == nil {
+		return "", fmt.Errorf("component %q is not available on responses", name)
+	}
+	switch name {
+	case "@method":
+		return req.Method, nil
+	case "@target-uri":
+		return message.scheme() + "://" + message.authority() + req.URL.RequestURI(), nil
+	case "@authority":
+		return message.authority(), nil
+	case "@scheme":
+		return message.scheme(), nil
+	case "@request-target":
+		return req.URL.RequestURI(), nil
+	case "@path":
+		if path := req.URL.EscapedPath(); path != "" {
+			return path, nil
+		}
+		return "/", nil
+	case "@query":
+		return "?" + req.URL.RawQuery, nil
+	case "@query-param":
+		param, _ := item.param("name").(string)
+		values := req.URL.Query()[param]
+		if len(values) != 1 {
+			return "", fmt.Errorf("query parameter %q must appear exactly once", param)
+		}
+		return strings.ReplaceAll(url.QueryEscape(values[0]), "+", "%20"), nil
+	}
+	return "", fmt.Errorf("unsupported derived component %q", name)
+}
+
+// scheme returns the lowercase scheme of the request
+func (message signedMessage) scheme() string {
+	if scheme := message.request.URL.Scheme; scheme != "" {
+		return strings.ToLower(scheme)
+	}
+	if message.request.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// authority returns the lowercase host of the request without a default port
+func (message signedMessage) authority() string {
+	host := message.request.Host
+	if host == "" {
+		host = message.request.URL.Host
+	}
+	host = strings.ToLower(host)
+	switch message.scheme() {
+	case "http":
+		host = strings.TrimSuffix(host, ":80")
+	case "https":
+		host = strings.TrimSuffix(host, ":443")
+	}
+	return host
+}
+
+// resolve returns the key with Key read from KeySource when it is nil
+func (key SignatureKey) resolve(ctx context.Context) (SignatureKey, error) {
+	if key.Key != nil || key.KeySource == nil {
+		return key, nil
+	}
+	secret, err := key.KeySource.Secret(ctx)
+	if err != nil {
+		return key, err
+	}
+	if key.Algorithm == SignatureHMACSHA256 {
+		key.Key = []byte(secret)
+		return key, nil
+	}
+	block, _ := pem.Decode([]byte(secret))
+	if block == nil {
+		return key, errors.New("signature key source returned no PEM block")
+	}
+	if key.Key, err = x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key.Key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key.Key, err = x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key.Key, err = x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key.Key, err = x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if certificate, err := x509.ParseCertificate(block.Bytes); err == nil {
+		key.Key = certificate.PublicKey
+		return key, nil
+	}
+	key.Key = nil
+	return key, fmt.Errorf("signature key source returned an unsupported %s block", block.Type)
+}
+
+// sign signs a signature base with the key
+func (key SignatureKey) sign(base []byte) ([]byte, error) {
+	switch key.Algorithm {
+	case SignatureHMACSHA256:
+		secret, ok := key.Key.([]byte)
+		if !ok {
+			return nil, key.typeError()
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(base)
+		return mac.Sum(nil), nil
+	case SignatureEd25519:
+		private, ok := key.Key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, key.typeError()
+		}
+		return ed25519.Sign(private, base), nil
+	case SignatureECDSAP256:
+		private, ok := key.Key.(*ecdsa.PrivateKey)
+		if !ok || private.Curve != elliptic.P256() {
+			return nil, key.typeError()
+		}
+		digest := sha256.Sum256(base)
+		r, s, err := ecdsa.Sign(rand.Reader, private, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		// the fixed-size r || s form, as in JWS
+		signature := make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+		return signature, nil
+	case SignatureRSAPSS:
+		private, ok := key.Key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, key.typeError()
+		}
+		digest := sha512.Sum512(base)
+		return rsa.SignPSS(rand.Reader, private, crypto.SHA512, digest[:], &rsa.PSSOptions{SaltLength: 64})
+	case SignatureRSAPKCS1v15:
+		private, ok := key.Key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, key.typeError()
+		}
+		digest := sha256.Sum256(base)
+		return rsa.SignPKCS1v15(rand.Reader, private, crypto.SHA256, digest[:])
+	}
+	return nil, fmt.Errorf("unsupported signature algorithm %q", key.Algorithm)
+}
+
+// verify checks signature over a signature base, accepting private keys in
+// place of their public keys
+func (key SignatureKey) verify(base []byte, signature []byte) error {
+	valid := false
+	switch key.Algorithm {
+	case SignatureHMACSHA256:
+		secret, ok := key.Key.([]byte)
+		if !ok {
+			return key.typeError()
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(base)
+		valid = hmac.Equal(mac.Sum(nil), signature)
+	case SignatureEd25519:
+		var public ed25519.PublicKey
+		switch k := key.Key.(type) {
+		case ed25519.PublicKey:
+			public = k
+		case ed25519.PrivateKey:
+			public = k.Public().(ed25519.PublicKey)
+		default:
+			return key.typeError()
+		}
+		valid = ed25519.Verify(public, base, signature)
+	case SignatureECDSAP256:
+		var public *ecdsa.PublicKey
+		switch k := key.Key.(type) {
+		case *ecdsa.PublicKey:
+			public = k
+		case *ecdsa.PrivateKey:
+			public = &k.PublicKey
+		default:
+			return key.typeError()
+		}
+		if public.Curve != elliptic.P256() {
+			return key.typeError()
+		}
+		digest := sha256.Sum256(base)
+		if len(signature) == 64 {
+			r := new(big.Int).SetBytes(signature[:32])
+			s := new(big.Int).SetBytes(signature[32:])
+			valid = ecdsa.Verify(public, digest[:], r, s)
+		}
+	case SignatureRSAPSS, SignatureRSAPKCS1v15:
+		var public *rsa.PublicKey
+		switch k := key.Key.(type) {
+		case *rsa.PublicKey:
+			public = k
+		case *rsa.PrivateKey:
+			public = &k.PublicKey
+		default:
+			return key.typeError()
+		}
+		if key.Algorithm == SignatureRSAPSS {
+			digest := sha512.Sum512(base)
+			valid = rsa.VerifyPSS(public, crypto.SHA512, digest[:], signature, &rsa.PSSOptions{SaltLength: 64}) == nil
+		} else {
+			digest := sha256.Sum256(base)
+			valid = rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], signature) == nil
+		}
+	default:
+		return fmt.Errorf("unsupported signature algorithm %q", key.Algorithm)
+	}
+	if !valid {
+		return errors.New("signature does not match")
+	}
+	return nil
+}
+
+func (key SignatureKey) typeError() error {
+	return fmt.Errorf("key %T cannot be used with %s", key.Key, key.Algorithm)
+}
@@ -0,0 +1,267 @@
+package webreq
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signature methods of OAuth 1.0a (RFC 5849 section 3.4)
+const (
+	OAuth1HMACSHA1  = "HMAC-SHA1"
+	OAuth1RSASHA1   = "RSA-SHA1"
+	OAuth1Plaintext = "PLAINTEXT"
+)
+
+// OAuth1Signer signs requests with OAuth 1.0a (RFC 5849). The signature
+// base string covers the method, the URL, the query and, for form encoded
+// bodies, the form parameters; the signature is sent in the Authorization
+// header with a fresh nonce and timestamp.
+type OAuth1Signer struct {
+	ConsumerKey    string
+	ConsumerSecret string
+	Token          string // empty for two-legged requests
+	TokenSecret    string
+	// ConsumerSecretSource and TokenSecretSource resolve the secrets at
+	// signing time, used when the values are empty
+	ConsumerSecretSource SecretSource
+	TokenSecretSource    SecretSource
+	// Method is the signature method, OAuth1HMACSHA1 when empty
+	Method string
+	// PrivateKey signs RSA-SHA1 requests
+	PrivateKey *rsa.PrivateKey
+	Realm      string
+	// Params are extra protocol parameters, such as oauth_callback or
+	// oauth_verifier during the token exchange
+	Params map[string]string
+
+	now   func() time.Time
+	nonce func() (string, error)
+}
+
+// NewOAuth1Signer creates an HMAC-SHA1 OAuth1Signer
+func NewOAuth1Signer(consumerKey string, consumerSecret string, token string, tokenSecret string) *OAuth1Signer {
+	return &OAuth1Signer{
+		ConsumerKey:    consumerKey,
+		ConsumerSecret: consumerSecret,
+		Token:          token,
+		TokenSecret:    tokenSecret,
+		Method:         OAuth1HMACSHA1,
+	}
+}
+
+// SetSignatureMethod sets the signature method, OAuth1HMACSHA1 or OAuth1Plaintext
+func (signer *OAuth1Signer) SetSignatureMethod(method string) *OAuth1Signer {
+	signer.Method = method
+	return signer
+}
+
+// SetRSAKey signs with RSA-SHA1 using key
+func (signer *OAuth1Signer) SetRSAKey(key *rsa.PrivateKey) *OAuth1Signer {
+	signer.Method = OAuth1RSASHA1
+	signer.PrivateKey = key
+	return signer
+}
+
+// SetSecretSources resolves the consumer and token secrets from sources at
+// signing time, either may be nil
+func (signer *OAuth1Signer) SetSecretSources(consumerSecret SecretSource, tokenSecret SecretSource) *OAuth1Signer {
+	signer.ConsumerSecretSource = consumerSecret
+	signer.TokenSecretSource = tokenSecret
+	return signer
+}
+
+// SetRealm sets the realm of the Authorization header
+func (signer *OAuth1Signer) SetRealm(realm string) *OAuth1Signer {
+	signer.Realm = realm
+	return signer
+}
+
+// SetParam adds a protocol parameter, such as oauth_callback
+func (signer *OAuth1Signer) SetParam(name string, value string) *OAuth1Signer {
+	if signer.Params == nil {
+		signer.Params = map[string]string{}
+	}
+	signer.Params[name] = value
+	return signer
+}
+
+// Authenticate signs req and sets its Authorization header
+func (signer *OAuth1Signer) Authenticate(ctx context.Context, req *http.Request) error {
+	method := signer.Method
+	if method == "" {
+		method = OAuth1HMACSHA1
+	}
+	nonce, err := signer.newNonce()
+	if err != nil {
+		return err
+	}
+
+	oauthParams := map[string]string{
+		"oauth_consumer_key":     signer.ConsumerKey,
+		"oauth_signature_method": method,
+		"oauth_timestamp":        strconv.FormatInt(signer.time().Unix(), 10),
+		"oauth_nonce":            nonce,
+		"oauth_version":          "1.0",
+	}
+	if signer.Token != "" {
+		oauthParams["oauth_token"] = signer.Token
+	}
+	for name, value := range signer.Params {
+		oauthParams[name] = value
+	}
+
+	var signature string
+	var key string
+	if method != OAuth1RSASHA1 {
+		consumerSecret, err := resolveSecret(ctx, signer.ConsumerSecret, signer.ConsumerSecretSource)
+		if err != nil {
+			return err
+		}
+		tokenSecret, err := resolveSecret(ctx, signer.TokenSecret, signer.TokenSecretSource)
+		if err != nil {
+			return err
+		}
+		key = oauth1Encode(consumerSecret) + "&" + oauth1Encode(tokenSecret)
+	}
+	switch method {
+	case OAuth1Plaintext:
+		signature = key
+	case OAuth1HMACSHA1, OAuth1RSASHA1:
+		base, err := oauth1BaseString(req, oauthParams)
+		if err != nil {
+			return err
+		}
+		if method == OAuth1HMACSHA1 {
+			mac := hmac.New(sha1.New, []byte(key))
+			mac.Write([]byte(base))
+			signature = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+			break
+		}
+		if signer.PrivateKey == nil {
+			return errors.New("oauth1: RSA-SHA1 needs a private key")
+		}
+		digest := sha1.Sum([]byte(base))
+		signed, err := rsa.SignPKCS1v15(rand.Reader, signer.PrivateKey, crypto.SHA1, digest[:])
+		if err != nil {
+			return err
+		}
+		signature = base64.StdEncoding.EncodeToString(signed)
+	default:
+		return fmt.Errorf("oauth1: unsupported signature method %q", method)
+	}
+	oauthParams["oauth_signature"] = signature
+
+	names := make([]string, 0, len(oauthParams))
+	for name := range oauthParams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fields := make([]string, 0, len(names)+1)
+	if signer.Realm != "" {
+		fields = append(fields, `realm="`+oauth1Encode(signer.Realm)+`"`)
+	}
+	for _, name := range names {
+		fields = append(fields, oauth1Encode(name)+`="`+oauth1Encode(oauthParams[name])+`"`)
+	}
+	req.Header.Set("Authorization", "OAuth "+strings.Join(fields, ", "))
+	return nil
+}
+
+func (signer *OAuth1Signer) time() time.Time {
+	if signer.now != nil {
+		return signer.now()
+	}
+	return time.Now()
+}
+
+func (signer *OAuth1Signer) newNonce() (string, error) {
+	if signer.nonce != nil {
+		return signer.nonce()
+	}
+	return randomCnonce()
+}
+
+// oauth1BaseString builds the signature base string (RFC 5849 section 3.4.1)
+func oauth1BaseString(req *http.Request, oauthParams map[string]string) (string, error) {
+	params, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return "", fmt.Errorf("oauth1: invalid query: %w", err)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); mediaType == "application/x-www-form-urlencoded" {
+		if req.Header.Get("Content-Encoding") != "" {
+			return "", errors.New("oauth1: cannot sign a compressed form body")
+		}
+		body, err := requestBody(req)
+		if err != nil {
+			return "", err
+		}
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return "", fmt.Errorf("oauth1: invalid form body: %w", err)
+		}
+		for name, values := range form {
+			params[name] = append(params[name], values...)
+		}
+	}
+	for name, value := range oauthParams {
+		params[name] = append(params[name], value)
+	}
+
+	type pair struct{ name, value string }
+	pairs := make([]pair, 0, len(params))
+	for name, values := range params {
+		for _, value := range values {
+			pairs = append(pairs, pair{oauth1Encode(name), oauth1Encode(value)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].name != pairs[j].name {
+			return pairs[i].name < pairs[j].name
+		}
+		return pairs[i].value < pairs[j].value
+	})
+	normalized := make([]string, len(pairs))
+	for i, p := range pairs {
+		normalized[i] = p.name + "=" + p.value
+	}
+
+	scheme := strings.ToLower(req.URL.Scheme)
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	host = strings.ToLower(host)
+	if (scheme == "http" && strings.HasSuffix(host, ":80")) || (scheme == "https" && strings.HasSuffix(host, ":443")) {
+		host = host[:strings.LastIndex(host, ":")]
+	}
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	return strings.Join([]string{
+		oauth1Encode(strings.ToUpper(req.Method)),
+		oauth1Encode(scheme + "://" + host + path),
+		oauth1Encode(strings.Join(normalized, "&")),
+	}, "&"), nil
+}
+
+// oauth1Encode percent-encodes every byte outside the unreserved set, as
+// RFC 5849 section 3.6 requires
+func oauth1Encode(value string) string {
+	return awsURIEncode(value)
+}
@@ -0,0 +1,376 @@
+package webreq
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeJWTBearer         = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+	// DefaultJWTLifetime is how long JWT bearer assertions are valid
+	DefaultJWTLifetime = 5 * time.Minute
+	// maxTokenResponseSize and tokenRequestTimeout bound token endpoint calls
+	maxTokenResponseSize = 1 << 20
+	tokenRequestTimeout  = 30 * time.Second
+)
+
+// OAuth2Config describes a client of an OAuth2 token endpoint
+type OAuth2Config struct {
+	TokenURL      string
+	AuthURL       string // authorization endpoint, for AuthorizationCode
+	DeviceAuthURL string // device authorization endpoint, for DeviceCode
+	RedirectURL   string // loopback redirect for AuthorizationCode, a random port when empty
+	ClientID      string
+	ClientSecret  string
+	// ClientSecretSource resolves the client secret for each token request,
+	// used when ClientSecret is empty
+	ClientSecretSource SecretSource
+	Scopes             []string
+	// AuthInParams sends the client credentials as form parameters instead
+	// of HTTP basic authentication. Public clients, without a secret, always
+	// send their client_id as a parameter.
+	AuthInParams bool
+	// EndpointParams are extra form parameters, such as audience or resource
+	EndpointParams url.Values
+	// Client calls the token endpoint, the default client when nil
+	Client *Client
+}
+
+// OAuth2Error is an error response of a token endpoint (RFC 6749 section 5.2)
+type OAuth2Error struct {
+	StatusCode  int
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+	URI         string `json:"error_uri"`
+}
+
+func (e *OAuth2Error) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("oauth2: %s: %s", e.Code, e.Description)
+	}
+	return fmt.Sprintf("oauth2: %s (status %d)", e.Code, e.StatusCode)
+}
+
+// TokenInvalidator is implemented by caching TokenSources, so a
+// TokenAuthenticator can drop a token the server rejected
+type TokenInvalidator interface {
+	InvalidateToken(token *Token)
+}
+
+// OAuth2TokenSource fetches tokens from a token endpoint and caches them.
+// Tokens are replaced EarlyExpiry before they expire, and concurrent callers
+// share a single fetch.
+type OAuth2TokenSource struct {
+	Config      *OAuth2Config
+	EarlyExpiry time.Duration
+
+	grant        func() (url.Values, error)
+	mu           sync.Mutex
+	token        *Token
+	refreshToken string
+	inflight     *tokenFetch
+}
+
+// tokenFetch is a token request shared by concurrent callers
+type tokenFetch struct {
+	done  chan struct{}
+	token *Token
+	err   error
+}
+
+// ClientCredentials creates a token source for the client_credentials grant
+func (config *OAuth2Config) ClientCredentials() *OAuth2TokenSource {
+	source := config.newTokenSource()
+	source.grant = func() (url.Values, error) {
+		return url.Values{"grant_type": {GrantTypeClientCredentials}}, nil
+	}
+	return source
+}
+
+// RefreshToken creates a token source exchanging refreshToken for access
+// tokens. Rotated refresh tokens returned by the server are used from then on.
+func (config *OAuth2Config) RefreshToken(refreshToken string) *OAuth2TokenSource {
+	source := config.newTokenSource()
+	source.refreshToken = refreshToken
+	source.grant = func() (url.Values, error) {
+		source.mu.Lock()
+		defer source.mu.Unlock()
+		if source.refreshToken == "" {
+			return nil, errors.New("oauth2: no refresh token")
+		}
+		return url.Values{
+			"grant_type":    {GrantTypeRefreshToken},
+			"refresh_token": {source.refreshToken},
+		}, nil
+	}
+	return source
+}
+
+// JWTBearer creates a token source for the JWT bearer grant (RFC 7523),
+// signing a fresh assertion for every fetch
+func (config *OAuth2Config) JWTBearer(assertion *JWTAssertion) *OAuth2TokenSource {
+	source := config.newTokenSource()
+	source.grant = func() (url.Values, error) {
+		signed, err := assertion.Sign()
+		if err != nil {
+			return nil, err
+		}
+		return url.Values{
+			"grant_type": {GrantTypeJWTBearer},
+			"assertion":  {signed},
+		}, nil
+	}
+	return source
+}
+
+func (config *OAuth2Config) newTokenSource() *OAuth2TokenSource {
+	return &OAuth2TokenSource{Config: config, EarlyExpiry: DefaultTokenLeeway}
+}
+
+// Token returns the cached token, or fetches one when it is missing or about
+// to expire. The fetch is shared by concurrent callers and runs on its own
+// context, so each caller only gives up on its own ctx.
+func (source *OAuth2TokenSource) Token(ctx context.Context) (*Token, error) {
+	source.mu.Lock()
+	if source.token.valid(source.EarlyExpiry) {
+		token := source.token
+		source.mu.Unlock()
+		return token, nil
+	}
+	fetch := source.inflight
+	if fetch == nil {
+		fetch = &tokenFetch{done: make(chan struct{})}
+		source.inflight = fetch
+		go source.fetch(fetch)
+	}
+	source.mu.Unlock()
+
+	select {
+	case <-fetch.done:
+		return fetch.token, fetch.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// InvalidateToken drops token from the cache when it is still the cached one
+func (source *OAuth2TokenSource) InvalidateToken(token *Token) {
+	source.mu.Lock()
+	defer source.mu.Unlock()
+	if source.token != nil && token != nil && source.token.AccessToken == token.AccessToken {
+		source.token = nil
+	}
+}
+
+func (source *OAuth2TokenSource) fetch(fetch *tokenFetch) {
+	ctx, cancel := context.WithTimeout(context.Background(), tokenRequestTimeout)
+	defer cancel()
+	token, refreshToken, err := source.request(ctx)
+
+	source.mu.Lock()
+	if err == nil {
+		source.token = token
+		if refreshToken != "" {
+			source.refreshToken = refreshToken
+		}
+	}
+	source.inflight = nil
+	source.mu.Unlock()
+
+	fetch.token, fetch.err = token, err
+	close(fetch.done)
+}
+
+// request performs one token request
+func (source *OAuth2TokenSource) request(ctx context.Context) (*Token, string, error) {
+	config := source.Config
+	params, err := source.grant()
+	if err != nil {
+		return nil, "", err
+	}
+	if len(config.Scopes) > 0 {
+		params.Set("scope", strings.Join(config.Scopes, " "))
+	}
+	for key, values := range config.EndpointParams {
+		params[key] = append([]string(nil), values...)
+	}
+	return postTokenRequest(ctx, config, params)
+}
+
+// postTokenRequest sends params to the token endpoint and parses the token
+// and any refresh token from the response
+func postTokenRequest(ctx context.Context, config *OAuth2Config, params url.Values) (*Token, string, error) {
+	clientSecret, err := resolveSecret(ctx, config.ClientSecret, config.ClientSecretSource)
+	if err != nil {
+		return nil, "", err
+	}
+	headers := HeadersMap{
+		"Content-Type": "application/x-www-form-urlencoded",
+		"Accept":       "application/json",
+	}
+	if config.AuthInParams || clientSecret == "" {
+		if config.ClientID != "" {
+			params.Set("client_id", config.ClientID)
+		}
+		if clientSecret != "" {
+			params.Set("client_secret", clientSecret)
+		}
+	} else if config.ClientID != "" {
+		credentials := url.QueryEscape(config.ClientID) + ":" + url.QueryEscape(clientSecret)
+		headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+	}
+
+	request := NewRequest("POST").SetMaxResponseSize(maxTokenResponseSize)
+	request.SetTimeouts(Timeouts{Overall: tokenRequestTimeout})
+	request.URL = config.TokenURL
+	request.Headers = headers
+	request.Data = []byte(params.Encode())
+	if config.Client != nil {
+		request.SetClient(config.Client)
+	}
+	request.SetAuth(noAuth{})
+	body, err := request.ExecuteWithContext(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	return parseTokenResponse(request.StatusCode, body)
+}
+
+// tokenResponse is a successful token endpoint response (RFC 6749 section 5.1)
+type tokenResponse struct {
+	AccessToken  string      `json:"access_token"`
+	TokenType    string      `json:"token_type"`
+	ExpiresIn    json.Number `json:"expires_in"`
+	RefreshToken string      `json:"refresh_token"`
+}
+
+func parseTokenResponse(statusCode int, body []byte) (*Token, string, error) {
+	if statusCode < 200 || statusCode > 299 {
+		oauthErr := &OAuth2Error{StatusCode: statusCode}
+		if json.Unmarshal(body, oauthErr) != nil || oauthErr.Code == "" {
+			oauthErr.Code = http.StatusText(statusCode)
+		}
+		return nil, "", oauthErr
+	}
+
+	var response tokenResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, "", fmt.Errorf("oauth2: invalid token response: %w", err)
+	}
+	if response.AccessToken == "" {
+		return nil, "", errors.New("oauth2: token response has no access_token")
+	}
+	token := &Token{AccessToken: response.AccessToken, TokenType: response.TokenType}
+	if seconds, err := response.ExpiresIn.Int64(); err == nil && seconds > 0 {
+		token.Expiry = time.Now().Add(time.Duration(seconds) * time.Second)
+	}
+	return token, response.RefreshToken, nil
+}
+
+// JWTAssertion builds the signed JWTs sent by the JWT bearer grant. Key must
+// be an *rsa.PrivateKey (RS256) or *ecdsa.PrivateKey on P-256 (ES256).
+type JWTAssertion struct {
+	Issuer   string
+	Subject  string
+	Audience string // usually the token URL
+	Lifetime time.Duration
+	KeyID    string
+	Key      crypto.Signer
+	Claims   map[string]interface{} // extra claims, such as scope
+}
+
+// Sign returns a new compact JWS for the assertion
+func (assertion *JWTAssertion) Sign() (string, error) {
+	var algorithm string
+	switch key := assertion.Key.(type) {
+	case *rsa.PrivateKey:
+		algorithm = "RS256"
+	case *ecdsa.PrivateKey:
+		if key.Curve.Params().BitSize != 256 {
+			return "", errors.New("oauth2: ecdsa assertion keys must use P-256")
+		}
+		algorithm = "ES256"
+	default:
+		return "", fmt.Errorf("oauth2: unsupported assertion key %T", assertion.Key)
+	}
+
+	header := map[string]interface{}{"alg": algorithm, "typ": "JWT"}
+	if assertion.KeyID != "" {
+		header["kid"] = assertion.KeyID
+	}
+
+	lifetime := assertion.Lifetime
+	if lifetime <= 0 {
+		lifetime = DefaultJWTLifetime
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := map[string]interface{}{}
+	for key, value := range assertion.Claims {
+		claims[key] = value
+	}
+	claims["iss"] = assertion.Issuer
+	claims["sub"] = assertion.Subject
+	claims["aud"] = assertion.Audience
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(lifetime).Unix()
+	claims["jti"] = hex.EncodeToString(nonce)
+
+	encodedHeader, err := encodeJWTPart(header)
+	if err != nil {
+		return "", err
+	}
+	encodedClaims, err := encodeJWTPart(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := encodedHeader + "." + encodedClaims
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+	switch key := assertion.Key.(type) {
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, key, digest[:])
+		if err == nil {
+			// JWS uses the fixed-size r || s form, not ASN.1
+			signature = make([]byte, 64)
+			r.FillBytes(signature[:32])
+			s.FillBytes(signature[32:])
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func encodeJWTPart(part map[string]interface{}) (string, error) {
+	encoded, err := json.Marshal(part)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(encoded), nil
+}
@@ -0,0 +1,278 @@
+package webreq
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+	// defaultLoopbackPath is the callback path used when RedirectURL is empty
+	defaultLoopbackPath = "/callback"
+)
+
+// devicePollUnit is the unit of device flow intervals, shortened by tests
+var devicePollUnit = time.Second
+
+var (
+	ErrLoginStateMismatch = errors.New("oauth2: state mismatch in authorization response")
+	ErrDeviceCodeExpired  = errors.New("oauth2: device code expired")
+)
+
+// AuthorizationCode runs the authorization code flow with PKCE (RFC 7636) for
+// a CLI. It listens on a loopback redirect URL, hands the authorization URL
+// to open, which usually launches a browser, waits for the redirect and
+// exchanges the code. The returned source keeps the token fresh with the
+// refresh token, if the server issued one.
+//
+// The listener uses RedirectURL when set, which must be an http URL on a
+// loopback address, and otherwise a random port of 127.0.0.1.
+func (config *OAuth2Config) AuthorizationCode(ctx context.Context, open func(authURL string) error) (*OAuth2TokenSource, error) {
+	if config.AuthURL == "" {
+		return nil, errors.New("oauth2: AuthURL is empty")
+	}
+	listener, redirectURL, err := config.listenLoopback()
+	if err != nil {
+		return nil, err
+	}
+	defer listener.Close()
+
+	verifier, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	state, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+
+	authURL, err := url.Parse(config.AuthURL)
+	if err != nil {
+		return nil, err
+	}
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", config.ClientID)
+	query.Set("redirect_uri", redirectURL.String())
+	query.Set("state", state)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	if len(config.Scopes) > 0 {
+		query.Set("scope", strings.Join(config.Scopes, " "))
+	}
+	authURL.RawQuery = query.Encode()
+
+	type callback struct {
+		code string
+		err  error
+	}
+	results := make(chan callback, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(redirectURL.Path, func(w http.ResponseWriter, r *http.Request) {
+		result := callback{code: r.URL.Query().Get("code")}
+		switch {
+		case r.URL.Query().Get("state") != state:
+			result.err = ErrLoginStateMismatch
+		case r.URL.Query().Get("error") != "":
+			result.err = &OAuth2Error{
+				Code:        r.URL.Query().Get("error"),
+				Description: r.URL.Query().Get("error_description"),
+				URI:         r.URL.Query().Get("error_uri"),
+			}
+		case result.code == "":
+			result.err = errors.New("oauth2: authorization response has no code")
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if result.err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprintf(w, "Login failed: %v\n", result.err)
+		} else {
+			_, _ = w.Write([]byte("Login complete, you can close this window.\n"))
+		}
+		select {
+		case results <- result:
+		default:
+		}
+	})
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() { _ = server.Serve(listener) }()
+	defer server.Close()
+
+	if err := open(authURL.String()); err != nil {
+		return nil, err
+	}
+
+	var result callback
+	select {
+	case result = <-results:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if result.err != nil {
+		return nil, result.err
+	}
+
+	token, refreshToken, err := postTokenRequest(ctx, config, url.Values{
+		"grant_type":    {GrantTypeAuthorizationCode},
+		"code":          {result.code},
+		"redirect_uri":  {redirectURL.String()},
+		"code_verifier": {verifier},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return config.sourceFor(token, refreshToken), nil
+}
+
+// listenLoopback opens the listener for the authorization code redirect
+func (config *OAuth2Config) listenLoopback() (net.Listener, *url.URL, error) {
+	redirectURL := &url.URL{Scheme: "http", Host: "127.0.0.1:0", Path: defaultLoopbackPath}
+	if config.RedirectURL != "" {
+		parsed, err := url.Parse(config.RedirectURL)
+		if err != nil {
+			return nil, nil, err
+		}
+		ip := net.ParseIP(parsed.Hostname())
+		if parsed.Scheme != "http" || (parsed.Hostname() != "localhost" && (ip == nil || !ip.IsLoopback())) {
+			return nil, nil, fmt.Errorf("oauth2: redirect url %q is not an http loopback url", config.RedirectURL)
+		}
+		redirectURL = parsed
+		if redirectURL.Path == "" {
+			redirectURL.Path = "/"
+		}
+	}
+
+	listener, err := net.Listen("tcp", redirectURL.Host)
+	if err != nil {
+		return nil, nil, err
+	}
+	if redirectURL.Port() == "0" || redirectURL.Port() == "" {
+		_, port, _ := net.SplitHostPort(listener.Addr().String())
+		redirectURL.Host = net.JoinHostPort(redirectURL.Hostname(), port)
+	}
+	return listener, redirectURL, nil
+}
+
+// DeviceAuthorization is the response of a device authorization endpoint
+// (RFC 8628 section 3.2). Show VerificationURI and UserCode to the user.
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// DeviceCode runs the device authorization grant (RFC 8628). It requests a
+// device code, passes it to prompt for display and polls the token endpoint
+// until the user approves, slowing down when asked to, and gives up with
+// ErrDeviceCodeExpired when the code expires.
+func (config *OAuth2Config) DeviceCode(ctx context.Context, prompt func(*DeviceAuthorization) error) (*OAuth2TokenSource, error) {
+	if config.DeviceAuthURL == "" {
+		return nil, errors.New("oauth2: DeviceAuthURL is empty")
+	}
+	params := url.Values{"client_id": {config.ClientID}}
+	if len(config.Scopes) > 0 {
+		params.Set("scope", strings.Join(config.Scopes, " "))
+	}
+
+	request := NewRequest("POST").SetMaxResponseSize(maxTokenResponseSize)
+	request.SetTimeouts(Timeouts{Overall: tokenRequestTimeout})
+	request.URL = config.DeviceAuthURL
+	request.Headers = HeadersMap{
+		"Content-Type": "application/x-www-form-urlencoded",
+		"Accept":       "application/json",
+	}
+	request.Data = []byte(params.Encode())
+	if config.Client != nil {
+		request.SetClient(config.Client)
+	}
+	request.SetAuth(noAuth{})
+	body, err := request.ExecuteWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if request.StatusCode < 200 || request.StatusCode > 299 {
+		_, _, err := parseTokenResponse(request.StatusCode, body)
+		return nil, err
+	}
+	authorization := &DeviceAuthorization{}
+	if err := json.Unmarshal(body, authorization); err != nil {
+		return nil, fmt.Errorf("oauth2: invalid device authorization response: %w", err)
+	}
+	if authorization.DeviceCode == "" {
+		return nil, errors.New("oauth2: device authorization response has no device_code")
+	}
+
+	if err := prompt(authorization); err != nil {
+		return nil, err
+	}
+
+	interval := time.Duration(authorization.Interval) * devicePollUnit
+	if authorization.Interval <= 0 {
+		interval = 5 * devicePollUnit
+	}
+	expires := time.Now().Add(time.Duration(authorization.ExpiresIn) * devicePollUnit)
+
+	for {
+		if authorization.ExpiresIn > 0 && time.Now().Add(interval).After(expires) {
+			return nil, ErrDeviceCodeExpired
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		token, refreshToken, err := postTokenRequest(ctx, config, url.Values{
+			"grant_type":  {GrantTypeDeviceCode},
+			"device_code": {authorization.DeviceCode},
+		})
+		if err == nil {
+			return config.sourceFor(token, refreshToken), nil
+		}
+
+		var oauthErr *OAuth2Error
+		if !errors.As(err, &oauthErr) {
+			return nil, err
+		}
+		switch oauthErr.Code {
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * devicePollUnit
+		case "expired_token":
+			return nil, fmt.Errorf("%w: %v", ErrDeviceCodeExpired, oauthErr)
+		default:
+			return nil, oauthErr
+		}
+	}
+}
+
+// sourceFor returns a refresh token source already holding token
+func (config *OAuth2Config) sourceFor(token *Token, refreshToken string) *OAuth2TokenSource {
+	source := config.RefreshToken(refreshToken)
+	source.token = token
+	return source
+}
+
+// randomToken returns n random bytes encoded with unpadded base64url
+func randomToken(n int) (string, error) {
+	buffer := make([]byte, n)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buffer), nil
+}
@@ -0,0 +1,157 @@
+package webreq
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http/httptrace"
+	"strings"
+)
+
+// pinPrefix is the optional prefix used by HPKP style pins
+const pinPrefix = "sha256/"
+
+// PinningError is returned when no certificate presented by a pinned host
+// matches any of its pins
+type PinningError struct {
+	Host       string
+	Expected   []string // configured pins, base64 SHA-256 of the SubjectPublicKeyInfo
+	Presented  []string // pins of the presented chain, leaf first
+	ReportOnly bool     // the mismatch was only reported, the connection went ahead
+}
+
+func (e *PinningError) Error() string {
+	return fmt.Sprintf("certificate pin mismatch for %s: presented %s, expected one of %s",
+		e.Host, strings.Join(e.Presented, ", "), strings.Join(e.Expected, ", "))
+}
+
+// SPKIPin returns the base64 SHA-256 hash of the certificate's SubjectPublicKeyInfo
+func SPKIPin(certificate *x509.Certificate) string {
+	sum := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// AddPin pins host to the given SPKI hashes. List backup pins alongside the
+// current one so a key rotation doesn't lock clients out. Pins are matched
+// against the TLS server name, or the dialled host when none is set, so
+// hosts may be IP addresses or "*.example.com" patterns.
+func (config *TLSConfig) AddPin(host string, pins ...string) *TLSConfig {
+	if config.Pins == nil {
+		config.Pins = make(map[string][]string)
+	}
+	for _, pin := range pins {
+		config.Pins[host] = append(config.Pins[host], strings.TrimPrefix(pin, pinPrefix))
+	}
+	return config
+}
+
+// SetPinMismatchHandler sets a callback run on every pin mismatch, for logging or reporting
+func (config *TLSConfig) SetPinMismatchHandler(handler func(*PinningError)) *TLSConfig {
+	config.OnPinMismatch = handler
+	return config
+}
+
+// SetPinReportOnly reports pin mismatches through the handler without failing the handshake
+func (config *TLSConfig) SetPinReportOnly(reportOnly bool) *TLSConfig {
+	config.PinReportOnly = reportOnly
+	return config
+}
+
+// verifyConnection is used as tls.Config.VerifyConnection for handshakes
+// webreq does not perform itself, such as through a proxy. crypto/tls sends
+// no server name for IP literals, so the pins of every host apply when the
+// name is unknown.
+func (config *TLSConfig) verifyConnection(state tls.ConnectionState) error {
+	host := state.ServerName
+	if host == "" {
+		host = config.ServerName
+	}
+	return config.verifyPins(host, state)
+}
+
+// verifyPins checks the chain presented by host against its pins
+func (config *TLSConfig) verifyPins(host string, state tls.ConnectionState) error {
+	host = strings.ToLower(host)
+	var expected []string
+	for pattern, pins := range config.Pins {
+		if host == "" || matchHost([]string{pattern}, host) {
+			expected = append(expected, pins...)
+		}
+	}
+	if len(expected) == 0 {
+		return nil
+	}
+
+	chain := state.PeerCertificates
+	if len(state.VerifiedChains) > 0 {
+		chain = state.VerifiedChains[0]
+	}
+	presented := make([]string, 0, len(chain))
+	for _, certificate := range chain {
+		pin := SPKIPin(certificate)
+		for _, want := range expected {
+			if pin == want {
+				return nil
+			}
+		}
+		presented = append(presented, pin)
+	}
+
+	pinningError := &PinningError{
+		Host:       host,
+		Expected:   expected,
+		Presented:  presented,
+		ReportOnly: config.PinReportOnly,
+	}
+	if config.OnPinMismatch != nil {
+		config.OnPinMismatch(pinningError)
+	}
+	if config.PinReportOnly {
+		return nil
+	}
+	return pinningError
+}
+
+// dialPinned returns a DialTLSContext performing the handshake itself, so
+// pins are matched against the dialled host even for IP literals
+func (config *TLSConfig) dialPinned(dial func(ctx context.Context, network string, address string) (net.Conn, error), base *tls.Config) func(ctx context.Context, network string, address string) (net.Conn, error) {
+	return func(ctx context.Context, network string, address string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := dial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig := base.Clone()
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = host
+		}
+		serverName := tlsConfig.ServerName
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			return config.verifyPins(serverName, state)
+		}
+
+		// the transport only reports handshakes it performs, so report this one
+		trace := httptrace.ContextClientTrace(ctx)
+		if trace != nil && trace.TLSHandshakeStart != nil {
+			trace.TLSHandshakeStart()
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		err = tlsConn.HandshakeContext(ctx)
+		if trace != nil && trace.TLSHandshakeDone != nil {
+			trace.TLSHandshakeDone(tlsConn.ConnectionState(), err)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+}
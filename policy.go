@@ -0,0 +1,223 @@
+package webreq
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	PolicyEnforce = "enforce" // violations fail the request
+	PolicyAudit   = "audit"   // violations are reported and the request is sent
+)
+
+// ErrPolicyDenied is wrapped by every PolicyViolation
+var ErrPolicyDenied = errors.New("request denied by policy")
+
+// PolicyRule describes one kind of call a service may make. Empty fields
+// match anything.
+type PolicyRule struct {
+	Hosts           []string `json:"hosts" yaml:"hosts"`                 // globs such as "api.example.com" or "*.example.com"
+	PathPrefixes    []string `json:"path_prefixes" yaml:"path_prefixes"` // "/v1" matches "/v1" and "/v1/users", not "/v10"
+	Methods         []string `json:"methods" yaml:"methods"`
+	MaxBodySize     int64    `json:"max_body_size" yaml:"max_body_size"` // bytes of Data before compression, zero is unlimited
+	RequiredHeaders []string `json:"required_headers" yaml:"required_headers"`
+}
+
+// Policy is a declarative allowlist of calls, evaluated before each request
+// of a Client is sent, after its Authenticator ran. A request must match at least one rule; in audit mode
+// a request matching none is reported to OnViolation and sent anyway.
+//
+// Redirect hops are not evaluated, use RedirectPolicy.AllowHosts for those.
+type Policy struct {
+	Mode        string                 `json:"mode" yaml:"mode"`
+	Rules       []PolicyRule           `json:"rules" yaml:"rules"`
+	OnViolation func(*PolicyViolation) `json:"-" yaml:"-"`
+}
+
+// PolicyViolation describes a request no rule of a Policy allowed, with
+// secrets redacted from its URL
+type PolicyViolation struct {
+	Method string
+	URL    string
+	Reason string
+	Audit  bool // the request was sent anyway
+}
+
+func (e *PolicyViolation) Error() string {
+	return fmt.Sprintf("%v: %s %s: %s", ErrPolicyDenied, e.Method, e.URL, e.Reason)
+}
+
+func (e *PolicyViolation) Unwrap() error {
+	return ErrPolicyDenied
+}
+
+// NewPolicy creates an enforcing Policy with the given rules
+func NewPolicy(rules ...PolicyRule) *Policy {
+	return &Policy{Mode: PolicyEnforce, Rules: rules}
+}
+
+// ParsePolicy reads a Policy from JSON, rejecting unknown fields so typos
+// don't silently widen it
+func ParsePolicy(data []byte) (*Policy, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	policy := &Policy{}
+	if err := decoder.Decode(policy); err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+	return policy.validate()
+}
+
+// ParsePolicyYAML reads a Policy from YAML, with the same field names and
+// checks as ParsePolicy
+func ParsePolicyYAML(data []byte) (*Policy, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	policy := &Policy{}
+	if err := decoder.Decode(policy); err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+	return policy.validate()
+}
+
+// LoadPolicy reads a Policy file, as YAML when it ends in .yaml or .yml and
+// as JSON otherwise
+func LoadPolicy(filename string) (*Policy, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return ParsePolicyYAML(data)
+	default:
+		return ParsePolicy(data)
+	}
+}
+
+// validate defaults the mode of a parsed Policy and rejects unknown modes
+func (policy *Policy) validate() (*Policy, error) {
+	if policy.Mode == "" {
+		policy.Mode = PolicyEnforce
+	}
+	if policy.Mode != PolicyEnforce && policy.Mode != PolicyAudit {
+		return nil, fmt.Errorf("invalid policy mode %q", policy.Mode)
+	}
+	return policy, nil
+}
+
+// SetMode switches between PolicyEnforce and PolicyAudit
+func (policy *Policy) SetMode(mode string) *Policy {
+	if mode == PolicyEnforce || mode == PolicyAudit {
+		policy.Mode = mode
+	}
+	return policy
+}
+
+// SetViolationHandler sets the function told about violations, in both modes
+func (policy *Policy) SetViolationHandler(handler func(*PolicyViolation)) *Policy {
+	policy.OnViolation = handler
+	return policy
+}
+
+// AddRule appends a rule to the policy
+func (policy *Policy) AddRule(rule PolicyRule) *Policy {
+	policy.Rules = append(policy.Rules, rule)
+	return policy
+}
+
+// evaluate returns a PolicyViolation when req must not be sent. Audit mode
+// reports the violation and returns nil.
+func (policy *Policy) evaluate(req *http.Request, bodySize int64, redactor *Redactor) error {
+	// report the first rule for the host, which is the one the caller most likely meant
+	reason := ""
+	for _, rule := range policy.Rules {
+		if !rule.matchesHost(req.URL.Hostname()) {
+			continue
+		}
+		ruleReason := rule.check(req, bodySize)
+		if ruleReason == "" {
+			return nil
+		}
+		if reason == "" {
+			reason = ruleReason
+		}
+	}
+	if reason == "" {
+		reason = "no rule matches host " + req.URL.Hostname()
+	}
+
+	violation := &PolicyViolation{
+		Method: req.Method,
+		URL:    redactor.redactURL(req.URL),
+		Reason: reason,
+		Audit:  policy.Mode == PolicyAudit,
+	}
+	if policy.OnViolation != nil {
+		policy.OnViolation(violation)
+	} else if violation.Audit {
+		log.Printf("webreq policy audit: %v", violation)
+	}
+	if violation.Audit {
+		return nil
+	}
+	return violation
+}
+
+func (rule PolicyRule) matchesHost(host string) bool {
+	if len(rule.Hosts) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	for _, pattern := range rule.Hosts {
+		if matched, _ := path.Match(strings.ToLower(pattern), host); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns why the rule doesn't allow req, or "" when it does
+func (rule PolicyRule) check(req *http.Request, bodySize int64) string {
+	if len(rule.Methods) > 0 && !containsFold(rule.Methods, req.Method) {
+		return "method " + req.Method + " not allowed"
+	}
+	if len(rule.PathPrefixes) > 0 && !matchPathPrefix(rule.PathPrefixes, req.URL.Path) {
+		return "path " + req.URL.Path + " not allowed"
+	}
+	if rule.MaxBodySize > 0 && bodySize > rule.MaxBodySize {
+		return fmt.Sprintf("body of %d bytes exceeds %d", bodySize, rule.MaxBodySize)
+	}
+	for _, header := range rule.RequiredHeaders {
+		if req.Header.Get(header) == "" {
+			return "missing required header " + header
+		}
+	}
+	return ""
+}
+
+// matchPathPrefix matches whole path segments of the cleaned path, so
+// "/v1/../admin" doesn't pass as "/v1"
+func matchPathPrefix(prefixes []string, requestPath string) bool {
+	if requestPath == "" {
+		requestPath = "/"
+	}
+	requestPath = path.Clean(requestPath)
+	for _, prefix := range prefixes {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if prefix == "" || requestPath == prefix || strings.HasPrefix(requestPath, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package webreq
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ProxyDirect used as a rule target sends matching hosts without a proxy
+const ProxyDirect = "direct"
+
+// ProxyRule sends requests for matching hosts through Proxy, or directly when Proxy is nil
+type ProxyRule struct {
+	Hosts []string // "api.example.com" or "*.example.com"
+	Proxy *url.URL
+}
+
+// ProxyConfig selects the proxy used for each request of a Client.
+// Rules are evaluated first, in order; requests matching none of them use
+// URL, or the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables
+// when FromEnvironment is set.
+//
+// Proxy URLs may use the http, https, socks5 or socks5h schemes, and
+// credentials in the URL are sent as proxy basic auth or SOCKS5
+// username/password authentication.
+type ProxyConfig struct {
+	FromEnvironment bool
+	URL             *url.URL
+	Rules           []ProxyRule
+	ConnectHeaders  http.Header // extra headers sent with CONNECT to HTTP proxies
+}
+
+// ProxyFromEnvironment creates a ProxyConfig that honours HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+func ProxyFromEnvironment() *ProxyConfig {
+	return &ProxyConfig{FromEnvironment: true}
+}
+
+// NewProxyConfig creates a ProxyConfig sending every request through the given proxy URL
+func NewProxyConfig(rawURL string) (*ProxyConfig, error) {
+	proxyURL, err := parseProxyURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &ProxyConfig{URL: proxyURL}, nil
+}
+
+// SetBasicAuth sets the credentials sent to the default proxy
+func (config *ProxyConfig) SetBasicAuth(username string, password string) *ProxyConfig {
+	if config.URL != nil {
+		config.URL.User = url.UserPassword(username, password)
+	}
+	return config
+}
+
+// SetConnectHeader sets a header sent with CONNECT requests to HTTP proxies
+func (config *ProxyConfig) SetConnectHeader(key string, value string) *ProxyConfig {
+	if config.ConnectHeaders == nil {
+		config.ConnectHeaders = make(http.Header)
+	}
+	config.ConnectHeaders.Set(key, value)
+	return config
+}
+
+// AddRule routes hosts matching pattern through rawURL, or directly when rawURL is ProxyDirect
+func (config *ProxyConfig) AddRule(pattern string, rawURL string) error {
+	rule := ProxyRule{Hosts: []string{pattern}}
+	if rawURL != ProxyDirect {
+		proxyURL, err := parseProxyURL(rawURL)
+		if err != nil {
+			return err
+		}
+		rule.Proxy = proxyURL
+	}
+	config.Rules = append(config.Rules, rule)
+	return nil
+}
+
+// proxy is used as http.Transport.Proxy
+func (config *ProxyConfig) proxy(req *http.Request) (*url.URL, error) {
+	host := req.URL.Hostname()
+	for _, rule := range config.Rules {
+		if matchHost(rule.Hosts, host) {
+			return rule.Proxy, nil
+		}
+	}
+	if config.URL != nil {
+		return config.URL, nil
+	}
+	if config.FromEnvironment {
+		return http.ProxyFromEnvironment(req)
+	}
+	return nil, nil
+}
+
+// connectHeader is used as http.Transport.GetProxyConnectHeader
+func (config *ProxyConfig) connectHeader(context.Context, *url.URL, string) (http.Header, error) {
+	return config.ConnectHeaders, nil
+}
+
+func parseProxyURL(rawURL string) (*url.URL, error) {
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(proxyURL.Scheme) {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("proxy url %q has no host", rawURL)
+	}
+	return proxyURL, nil
+}
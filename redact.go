@@ -0,0 +1,280 @@
+package webreq
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// RedactedValue replaces every secret in dumps, logs and errors
+const RedactedValue = "[REDACTED]"
+
+var (
+	DefaultSensitiveHeaders = []string{
+		"Authorization",
+		"Cookie",
+		"Proxy-Authorization",
+		"Set-Cookie",
+		"X-Api-Key",
+	}
+	DefaultSensitiveQueryParams = []string{
+		"access_token",
+		"api_key",
+		"apikey",
+		"client_secret",
+		"password",
+		"token",
+	}
+	DefaultSensitiveJSONFields = []string{
+		"access_token",
+		"client_secret",
+		"password",
+		"refresh_token",
+	}
+)
+
+// Redactor hides secrets in headers, query strings and JSON bodies before
+// they reach dumps, logs or error messages.
+//
+// Header and query parameter names match case-insensitively. A JSON field
+// path without dots, such as "password", matches that field at any depth;
+// a dotted path such as "user.credentials.*" matches from the root, with "*"
+// standing for any field. Arrays are transparent, so "items.secret" matches
+// the secret of every element of items.
+type Redactor struct {
+	Headers     []string
+	QueryParams []string
+	JSONFields  []string
+}
+
+// defaultRedactor is used by requests whose Client has no Redactor
+var defaultRedactor = NewRedactor()
+
+// NewRedactor creates a Redactor with the default sensitive names
+func NewRedactor() *Redactor {
+	return &Redactor{
+		Headers:     append([]string(nil), DefaultSensitiveHeaders...),
+		QueryParams: append([]string(nil), DefaultSensitiveQueryParams...),
+		JSONFields:  append([]string(nil), DefaultSensitiveJSONFields...),
+	}
+}
+
+// AddHeaders marks more header names as sensitive
+func (redactor *Redactor) AddHeaders(names ...string) *Redactor {
+	redactor.Headers = append(redactor.Headers, names...)
+	return redactor
+}
+
+// AddQueryParams marks more query parameter names as sensitive
+func (redactor *Redactor) AddQueryParams(names ...string) *Redactor {
+	redactor.QueryParams = append(redactor.QueryParams, names...)
+	return redactor
+}
+
+// AddJSONFields marks more JSON field paths as sensitive
+func (redactor *Redactor) AddJSONFields(paths ...string) *Redactor {
+	redactor.JSONFields = append(redactor.JSONFields, paths...)
+	return redactor
+}
+
+// Header returns a copy of header with sensitive values replaced
+func (redactor *Redactor) Header(header http.Header) http.Header {
+	redacted := make(http.Header, len(header))
+	for key, values := range header {
+		if containsFold(redactor.Headers, key) {
+			values = []string{RedactedValue}
+		}
+		redacted[key] = append([]string(nil), values...)
+	}
+	return redacted
+}
+
+// URL returns rawURL with its password and sensitive query values replaced.
+// Unparseable URLs lose everything after their path.
+func (redactor *Redactor) URL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		if end := strings.IndexAny(rawURL, "?#"); end >= 0 {
+			return rawURL[:end] + "?" + RedactedValue
+		}
+		return rawURL
+	}
+	return redactor.redactURL(parsed)
+}
+
+func (redactor *Redactor) redactURL(target *url.URL) string {
+	redacted := *target
+	if redacted.User != nil {
+		if _, ok := redacted.User.Password(); ok {
+			redacted.User = url.UserPassword(redacted.User.Username(), RedactedValue)
+		}
+	}
+	redacted.RawQuery = redactor.Form(redacted.RawQuery)
+	return unescapeRedacted(redacted.String())
+}
+
+// Form returns a URL-encoded query or form body with sensitive values replaced
+func (redactor *Redactor) Form(encoded string) string {
+	if encoded == "" {
+		return encoded
+	}
+	values, err := url.ParseQuery(encoded)
+	if err != nil {
+		return RedactedValue
+	}
+	changed := false
+	for key := range values {
+		if containsFold(redactor.QueryParams, key) {
+			values[key] = []string{RedactedValue}
+			changed = true
+		}
+	}
+	if !changed {
+		return encoded
+	}
+	return unescapeRedacted(values.Encode())
+}
+
+// unescapeRedacted keeps RedactedValue readable after URL encoding
+func unescapeRedacted(encoded string) string {
+	return strings.ReplaceAll(encoded, url.QueryEscape(RedactedValue), RedactedValue)
+}
+
+// JSON returns body with sensitive fields replaced. Bodies that aren't JSON
+// are returned unchanged.
+func (redactor *Redactor) JSON(body []byte) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return body
+	}
+	if !redactor.redactValue(document, nil) {
+		return body
+	}
+	redacted, err := json.Marshal(document)
+	if err != nil {
+		return body
+	}
+	return redacted
+}
+
+// redactValue replaces sensitive fields in place and reports whether any were found
+func (redactor *Redactor) redactValue(value interface{}, path []string) bool {
+	changed := false
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, child := range typed {
+			childPath := append(path[:len(path):len(path)], key)
+			if redactor.sensitiveField(childPath) {
+				typed[key] = RedactedValue
+				changed = true
+				continue
+			}
+			if redactor.redactValue(child, childPath) {
+				changed = true
+			}
+		}
+	case []interface{}:
+		for _, child := range typed {
+			if redactor.redactValue(child, path) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+func (redactor *Redactor) sensitiveField(path []string) bool {
+	for _, field := range redactor.JSONFields {
+		if !strings.Contains(field, ".") {
+			if strings.EqualFold(field, path[len(path)-1]) {
+				return true
+			}
+			continue
+		}
+		segments := strings.Split(field, ".")
+		if len(segments) != len(path) {
+			continue
+		}
+		matched := true
+		for i, segment := range segments {
+			if segment != "*" && !strings.EqualFold(segment, path[i]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Error redacts the URL of a *url.Error, as returned by http.Client, in place
+func (redactor *Redactor) Error(err error) error {
+	var urlError *url.Error
+	if errors.As(err, &urlError) {
+		urlError.URL = redactor.URL(urlError.URL)
+	}
+	return err
+}
+
+// Dump renders the request as it would be sent, with secrets redacted, for
+// debug output
+func (request *Request) Dump() string {
+	redactor := request.redactor()
+	var dump strings.Builder
+	dump.WriteString(request.Method + " " + redactor.URL(request.URL) + "\n")
+
+	header := make(http.Header)
+	if request.Client != nil {
+		for key, value := range request.Client.Headers {
+			header.Set(key, value)
+		}
+	}
+	for key, value := range request.Headers {
+		header.Set(key, value)
+	}
+	header = redactor.Header(header)
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range header[key] {
+			dump.WriteString(key + ": " + value + "\n")
+		}
+	}
+
+	if len(request.Data) > 0 {
+		dump.WriteString("\n")
+		if strings.HasPrefix(header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+			dump.WriteString(redactor.Form(string(request.Data)))
+		} else {
+			dump.Write(redactor.JSON(request.Data))
+		}
+		dump.WriteString("\n")
+	}
+	return dump.String()
+}
+
+// redactor returns the Redactor of the request's Client, or the default one,
+// extended with the query parameters its Authenticator reports as sensitive
+func (request *Request) redactor() *Redactor {
+	redactor := defaultRedactor
+	if request.Client != nil && request.Client.Redactor != nil {
+		redactor = request.Client.Redactor
+	}
+	if auth, ok := request.authenticator().(SensitiveQueryAuthenticator); ok {
+		extended := *redactor
+		extended.QueryParams = append(append([]string(nil), redactor.QueryParams...), auth.SensitiveQueryParams()...)
+		return &extended
+	}
+	return redactor
+}
@@ -0,0 +1,204 @@
+package webreq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultMaxRedirects matches the limit used by net/http
+const DefaultMaxRedirects = 10
+
+var (
+	ErrTooManyRedirects    = errors.New("too many redirects")
+	ErrRedirectDowngrade   = errors.New("redirect from https to http blocked")
+	ErrRedirectNotAllowed  = errors.New("redirect target not allowed")
+	defaultCrossOriginKeep = []string{
+		"Accept",
+		"Accept-Encoding",
+		"Accept-Language",
+		"Content-Encoding",
+		"Content-Language",
+		"Content-Type",
+		"User-Agent",
+	}
+)
+
+// RedirectPolicy controls which redirects are followed and which headers
+// survive them.
+type RedirectPolicy struct {
+	MaxRedirects   int      // zero disables following redirects
+	AllowedSchemes []string // empty allows http and https
+	AllowedHosts   []string // empty allows any host; "*.example.com" matches subdomains
+	AllowDowngrade bool     // follow https to http redirects
+	// CrossOriginHeaders lists the headers forwarded when a redirect changes
+	// scheme, host or port. Every other header, including Authorization and
+	// Cookie, is dropped on such hops.
+	CrossOriginHeaders []string
+}
+
+// NewRedirectPolicy creates a RedirectPolicy following up to DefaultMaxRedirects
+// hops, blocking downgrades and forwarding only content negotiation headers
+// across origins
+func NewRedirectPolicy() *RedirectPolicy {
+	return &RedirectPolicy{
+		MaxRedirects:       DefaultMaxRedirects,
+		CrossOriginHeaders: append([]string(nil), defaultCrossOriginKeep...),
+	}
+}
+
+// SetMaxRedirects sets how many hops are followed, zero disables redirects
+func (policy *RedirectPolicy) SetMaxRedirects(max int) *RedirectPolicy {
+	if max >= 0 {
+		policy.MaxRedirects = max
+	}
+	return policy
+}
+
+// AllowSchemes restricts redirects to the given URL schemes
+func (policy *RedirectPolicy) AllowSchemes(schemes ...string) *RedirectPolicy {
+	policy.AllowedSchemes = append(policy.AllowedSchemes, schemes...)
+	return policy
+}
+
+// AllowHosts restricts redirects to the given hosts
+func (policy *RedirectPolicy) AllowHosts(hosts ...string) *RedirectPolicy {
+	policy.AllowedHosts = append(policy.AllowedHosts, hosts...)
+	return policy
+}
+
+// KeepCrossOriginHeaders adds headers forwarded on cross-origin hops
+func (policy *RedirectPolicy) KeepCrossOriginHeaders(headers ...string) *RedirectPolicy {
+	policy.CrossOriginHeaders = append(policy.CrossOriginHeaders, headers...)
+	return policy
+}
+
+// check validates a hop and strips headers that must not cross origins
+func (policy *RedirectPolicy) check(req *http.Request, via []*http.Request) error {
+	if policy.MaxRedirects == 0 {
+		return http.ErrUseLastResponse
+	}
+	if len(via) > policy.MaxRedirects {
+		return fmt.Errorf("%w: stopped after %d", ErrTooManyRedirects, policy.MaxRedirects)
+	}
+
+	previous := via[len(via)-1]
+	scheme := strings.ToLower(req.URL.Scheme)
+	if previous.URL.Scheme == "https" && scheme == "http" && !policy.AllowDowngrade {
+		return fmt.Errorf("%w: %s", ErrRedirectDowngrade, req.URL.Host)
+	}
+	if !policy.schemeAllowed(scheme) {
+		return fmt.Errorf("%w: scheme %q", ErrRedirectNotAllowed, scheme)
+	}
+	if len(policy.AllowedHosts) > 0 && !matchHost(policy.AllowedHosts, req.URL.Hostname()) {
+		return fmt.Errorf("%w: host %q", ErrRedirectNotAllowed, req.URL.Hostname())
+	}
+
+	if !sameOrigin(via[0], req) {
+		keep := make(map[string]bool, len(policy.CrossOriginHeaders))
+		for _, header := range policy.CrossOriginHeaders {
+			keep[http.CanonicalHeaderKey(header)] = true
+		}
+		for header := range req.Header {
+			if !keep[header] {
+				req.Header.Del(header)
+			}
+		}
+	}
+	return nil
+}
+
+func (policy *RedirectPolicy) schemeAllowed(scheme string) bool {
+	if len(policy.AllowedSchemes) == 0 {
+		return scheme == "http" || scheme == "https"
+	}
+	for _, allowed := range policy.AllowedSchemes {
+		if strings.EqualFold(allowed, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchHost reports whether host matches one of the patterns, where a
+// leading "*." matches any subdomain
+func matchHost(patterns []string, host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if pattern == host {
+			return true
+		}
+		if strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameOrigin(a *http.Request, b *http.Request) bool {
+	return strings.EqualFold(a.URL.Scheme, b.URL.Scheme) &&
+		strings.EqualFold(a.URL.Hostname(), b.URL.Hostname()) &&
+		portOf(a) == portOf(b)
+}
+
+func portOf(req *http.Request) string {
+	if port := req.URL.Port(); port != "" {
+		return port
+	}
+	if strings.EqualFold(req.URL.Scheme, "https") {
+		return "443"
+	}
+	return "80"
+}
+
+// redirectState carries the policy of one execution and records its hops
+type redirectState struct {
+	policy    *RedirectPolicy
+	redirects []Redirect
+}
+
+type redirectStateKey struct{}
+
+// checkRedirect is the CheckRedirect of every webreq http.Client. It applies
+// the policy of the executing Request, if any, and records each hop.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	// a remote server must never steer a request onto a local socket
+	if strings.EqualFold(req.URL.Scheme, SchemeHTTPUnix) {
+		return fmt.Errorf("%w: %s URLs cannot be redirected to", ErrRedirectNotAllowed, SchemeHTTPUnix)
+	}
+
+	state, _ := req.Context().Value(redirectStateKey{}).(*redirectState)
+	if state == nil {
+		return defaultCheckRedirect(via)
+	}
+
+	if state.policy != nil {
+		if err := state.policy.check(req, via); err != nil {
+			return err
+		}
+	} else if err := defaultCheckRedirect(via); err != nil {
+		return err
+	}
+
+	hop := Redirect{URL: req.URL.String()}
+	if req.Response != nil {
+		hop.StatusCode = req.Response.StatusCode
+	}
+	state.redirects = append(state.redirects, hop)
+	return nil
+}
+
+// defaultCheckRedirect mirrors the net/http default policy
+func defaultCheckRedirect(via []*http.Request) error {
+	if len(via) >= DefaultMaxRedirects {
+		return fmt.Errorf("%w: stopped after %d", ErrTooManyRedirects, DefaultMaxRedirects)
+	}
+	return nil
+}
+
+func withRedirectState(ctx context.Context, state *redirectState) context.Context {
+	return context.WithValue(ctx, redirectStateKey{}, state)
+}
@@ -0,0 +1,17 @@
+package webreq
+
+import "net/http"
+
+// Response holds details about the last execution of a Request
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Redirects  []Redirect // hops followed before the final response, in order
+	Timings    Timings    // where the time of the execution went
+}
+
+// Redirect is a single hop followed while executing a Request
+type Redirect struct {
+	URL        string // location the request was redirected to
+	StatusCode int    // status of the response that caused the redirect
+}
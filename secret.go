@@ -0,0 +1,191 @@
+package webreq
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSecretReloadInterval is how often a FileSecret checks its file
+	DefaultSecretReloadInterval = 10 * time.Second
+	// DefaultCommandSecretTTL is how long a CommandSecret caches its output
+	DefaultCommandSecretTTL = 5 * time.Minute
+	// DefaultCommandSecretTimeout bounds a CommandSecret command
+	DefaultCommandSecretTimeout = 30 * time.Second
+)
+
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretSource resolves a credential when a request is sent, so it does not
+// have to live in the program's configuration or on the Request
+type SecretSource interface {
+	Secret(ctx context.Context) (string, error)
+}
+
+// SecretFunc adapts a function to the SecretSource interface
+type SecretFunc func(ctx context.Context) (string, error)
+
+func (f SecretFunc) Secret(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// StaticSecret is a SecretSource for a fixed value
+type StaticSecret string
+
+func (secret StaticSecret) Secret(ctx context.Context) (string, error) {
+	return string(secret), nil
+}
+
+// EnvSecret reads the secret from the named environment variable on every use
+type EnvSecret string
+
+func (name EnvSecret) Secret(ctx context.Context) (string, error) {
+	value := os.Getenv(string(name))
+	if value == "" {
+		return "", fmt.Errorf("%w: environment variable %s is not set", ErrSecretNotFound, string(name))
+	}
+	return value, nil
+}
+
+// FileSecret reads the secret from a file, such as a Kubernetes secret
+// volume, and reloads it when the file changes. Trailing newlines are
+// removed. When the file disappears or cannot be read after the first load,
+// the last value stays in use, as mounted secrets are briefly missing while
+// they are swapped.
+type FileSecret struct {
+	Path string
+	// ReloadInterval is how long the file is trusted before it is checked
+	// again for changes, zero checks it on every use
+	ReloadInterval time.Duration
+
+	mu      sync.Mutex
+	value   string
+	stamp   fileStamp
+	checked time.Time
+}
+
+// NewFileSecret creates a FileSecret checking path every DefaultSecretReloadInterval
+func NewFileSecret(path string) *FileSecret {
+	return &FileSecret{Path: path, ReloadInterval: DefaultSecretReloadInterval}
+}
+
+// SetReloadInterval sets how often the file is checked for changes
+func (secret *FileSecret) SetReloadInterval(interval time.Duration) *FileSecret {
+	secret.ReloadInterval = interval
+	return secret
+}
+
+// Secret returns the contents of the file, reading it again if it changed
+func (secret *FileSecret) Secret(ctx context.Context) (string, error) {
+	secret.mu.Lock()
+	defer secret.mu.Unlock()
+
+	loaded := !secret.checked.IsZero()
+	if loaded && time.Since(secret.checked) < secret.ReloadInterval {
+		return secret.value, nil
+	}
+	stamp, err := stampOf(secret.Path)
+	if err == nil && loaded && stamp == secret.stamp {
+		secret.checked = time.Now()
+		return secret.value, nil
+	}
+	var data []byte
+	if err == nil {
+		data, err = os.ReadFile(secret.Path)
+	}
+	if err == nil && len(bytes.TrimRight(data, "\r\n")) == 0 {
+		err = fmt.Errorf("%w: %s is empty", ErrSecretNotFound, secret.Path)
+	}
+	if err != nil {
+		if loaded {
+			return secret.value, nil
+		}
+		return "", fmt.Errorf("secret: %w", err)
+	}
+
+	secret.value = string(bytes.TrimRight(data, "\r\n"))
+	secret.stamp = stamp
+	secret.checked = time.Now()
+	return secret.value, nil
+}
+
+// CommandSecret runs a command, such as a password manager or cloud CLI, and
+// uses its trimmed standard output as the secret, caching it for TTL
+type CommandSecret struct {
+	Command []string
+	// TTL is how long the output is reused, zero runs the command on every use
+	TTL     time.Duration
+	Timeout time.Duration
+
+	mu      sync.Mutex
+	value   string
+	fetched time.Time
+}
+
+// NewCommandSecret creates a CommandSecret running name with args
+func NewCommandSecret(name string, args ...string) *CommandSecret {
+	return &CommandSecret{
+		Command: append([]string{name}, args...),
+		TTL:     DefaultCommandSecretTTL,
+		Timeout: DefaultCommandSecretTimeout,
+	}
+}
+
+// SetTTL sets how long the command output is reused
+func (secret *CommandSecret) SetTTL(ttl time.Duration) *CommandSecret {
+	secret.TTL = ttl
+	return secret
+}
+
+// Secret returns the cached output, running the command when it is stale.
+// Concurrent callers wait for a single run.
+func (secret *CommandSecret) Secret(ctx context.Context) (string, error) {
+	secret.mu.Lock()
+	defer secret.mu.Unlock()
+
+	if secret.value != "" && time.Since(secret.fetched) < secret.TTL {
+		return secret.value, nil
+	}
+	if len(secret.Command) == 0 {
+		return "", errors.New("secret: command is empty")
+	}
+	if secret.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, secret.Timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	command := exec.CommandContext(ctx, secret.Command[0], secret.Command[1:]...)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+	if err := command.Run(); err != nil {
+		// stdout is left out of the error as it may hold part of the secret
+		if message, _, _ := strings.Cut(strings.TrimSpace(stderr.String()), "\n"); message != "" {
+			return "", fmt.Errorf("secret: command %s failed: %w: %s", secret.Command[0], err, message)
+		}
+		return "", fmt.Errorf("secret: command %s failed: %w", secret.Command[0], err)
+	}
+	value := strings.TrimSpace(stdout.String())
+	if value == "" {
+		return "", fmt.Errorf("%w: command %s printed nothing", ErrSecretNotFound, secret.Command[0])
+	}
+	secret.value = value
+	secret.fetched = time.Now()
+	return value, nil
+}
+
+// resolveSecret returns value, or the secret of source when value is empty
+func resolveSecret(ctx context.Context, value string, source SecretSource) (string, error) {
+	if value != "" || source == nil {
+		return value, nil
+	}
+	return source.Secret(ctx)
+}
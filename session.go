@@ -0,0 +1,92 @@
+package webreq
+
+import (
+	"errors"
+	"io"
+	"net/http/cookiejar"
+	"os"
+	"path/filepath"
+)
+
+// Session keeps cookies and default headers across requests, so flows like
+// login-then-call work without handling Set-Cookie by hand.
+type Session struct {
+	Client     *Client
+	Jar        *Jar
+	CookieFile string // where Save writes cookies, in the format described on Jar.Export
+}
+
+// NewSession creates a Session with an empty cookie jar using publicsuffix.List
+func NewSession() *Session {
+	return NewSessionWithSuffixList(nil)
+}
+
+// NewSessionWithSuffixList creates a Session whose jar uses the given public suffix list
+func NewSessionWithSuffixList(publicSuffixList cookiejar.PublicSuffixList) *Session {
+	jar := NewJar(publicSuffixList)
+	return &Session{
+		Client: NewClient().SetJar(jar),
+		Jar:    jar,
+	}
+}
+
+// NewRequest creates a new Request with the specified method bound to the session
+func (session *Session) NewRequest(method string) *Request {
+	return NewRequest(method).SetClient(session.Client)
+}
+
+// SetHeader sets a default header sent with every request of the session
+func (session *Session) SetHeader(key string, value string) *Session {
+	session.Client.SetHeader(key, value)
+	return session
+}
+
+// SetCookieFile sets the file used to persist cookies and loads it when it already exists
+func (session *Session) SetCookieFile(path string) error {
+	session.CookieFile = path
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return session.Jar.Import(file)
+}
+
+// Save writes the session cookies to CookieFile, readable only by the owner
+func (session *Session) Save() error {
+	if session.CookieFile == "" {
+		return errors.New("cookie file is empty")
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(session.CookieFile), ".webreq-cookies-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if err := temp.Chmod(0600); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := session.Jar.Export(temp); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), session.CookieFile)
+}
+
+// ExportCookies writes the session cookies in Netscape cookies.txt format
+func (session *Session) ExportCookies(w io.Writer) error {
+	return session.Jar.Export(w)
+}
+
+// ImportCookies reads cookies in Netscape cookies.txt format into the session
+func (session *Session) ImportCookies(r io.Reader) error {
+	return session.Jar.Import(r)
+}
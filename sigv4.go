@@ -0,0 +1,419 @@
+package webreq
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	PayloadSigned    = ""                                   // hash the whole body
+	PayloadUnsigned  = "UNSIGNED-PAYLOAD"                   // leave the body out of the signature
+	PayloadStreaming = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD" // sign the body chunk by chunk (aws-chunked)
+
+	// DefaultSigV4ChunkSize is the chunk size of streaming payloads
+	DefaultSigV4ChunkSize = 64 * 1024
+
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat = "20060102T150405Z"
+	emptySHA256     = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// AWSCredentials are the keys SigV4 signs with. SessionToken is set for
+// temporary credentials from STS.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// SecretAccessKeySource and SessionTokenSource resolve the secret key
+	// and session token at signing time, used when the values are empty
+	SecretAccessKeySource SecretSource
+	SessionTokenSource    SecretSource
+}
+
+// resolve returns the credentials with values from their sources filled in
+func (credentials AWSCredentials) resolve(ctx context.Context) (AWSCredentials, error) {
+	var err error
+	if credentials.SecretAccessKey == "" && credentials.SecretAccessKeySource != nil {
+		if credentials.SecretAccessKey, err = credentials.SecretAccessKeySource.Secret(ctx); err != nil {
+			return credentials, err
+		}
+	}
+	if credentials.SessionToken == "" && credentials.SessionTokenSource != nil {
+		if credentials.SessionToken, err = credentials.SessionTokenSource.Secret(ctx); err != nil {
+			return credentials, err
+		}
+	}
+	return credentials, nil
+}
+
+// SigV4Signer signs requests with AWS Signature Version 4. Used as an
+// Authenticator it adds the Authorization header at send time, once the final
+// body and headers are known; Presign creates presigned URLs instead.
+//
+// For the "s3" service the path is not escaped a second time and the
+// x-amz-content-sha256 header is always sent, as S3 requires.
+type SigV4Signer struct {
+	Credentials AWSCredentials
+	Region      string
+	Service     string
+	Payload     string // PayloadSigned, PayloadUnsigned or PayloadStreaming
+	ChunkSize   int    // chunk size of PayloadStreaming, DefaultSigV4ChunkSize when zero
+
+	now func() time.Time
+}
+
+// NewSigV4Signer creates a SigV4Signer hashing the whole payload
+func NewSigV4Signer(credentials AWSCredentials, region string, service string) *SigV4Signer {
+	return &SigV4Signer{Credentials: credentials, Region: region, Service: service}
+}
+
+// SetUnsignedPayload leaves the body out of the signature
+func (signer *SigV4Signer) SetUnsignedPayload() *SigV4Signer {
+	signer.Payload = PayloadUnsigned
+	return signer
+}
+
+// SetStreamingPayload sends the body aws-chunked, signing each chunk
+func (signer *SigV4Signer) SetStreamingPayload(chunkSize int) *SigV4Signer {
+	signer.Payload = PayloadStreaming
+	signer.ChunkSize = chunkSize
+	return signer
+}
+
+// Authenticate signs req in header mode
+func (signer *SigV4Signer) Authenticate(ctx context.Context, req *http.Request) error {
+	now := signer.time()
+	amzDate := now.Format(sigV4TimeFormat)
+
+	credentials, err := signer.Credentials.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	key := signer.signingKey(credentials, now)
+
+	body, err := requestBody(req)
+	if err != nil {
+		return err
+	}
+
+	payloadHash := signer.Payload
+	switch signer.Payload {
+	case PayloadSigned:
+		payloadHash = hashSHA256(body)
+	case PayloadUnsigned:
+	case PayloadStreaming:
+		req.Header.Set("X-Amz-Decoded-Content-Length", strconv.Itoa(len(body)))
+		if encoding := req.Header.Get("Content-Encoding"); encoding != "" {
+			req.Header.Set("Content-Encoding", "aws-chunked,"+encoding)
+		} else {
+			req.Header.Set("Content-Encoding", "aws-chunked")
+		}
+		req.ContentLength = streamingLength(len(body), signer.chunkSize())
+	default:
+		return fmt.Errorf("unsupported sigv4 payload %q", signer.Payload)
+	}
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", credentials.SessionToken)
+	}
+	if signer.Service == "s3" || signer.Payload != PayloadSigned {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	headers, signedHeaders := signer.canonicalHeaders(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		signer.canonicalPath(req.URL),
+		canonicalQuery(req.URL.Query()),
+		headers,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	signature := signer.sign(key, now, canonicalRequest)
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, credentials.AccessKeyID, signer.scope(now), signedHeaders, signature))
+
+	if signer.Payload == PayloadStreaming {
+		chunked := signer.chunkBody(key, now, signature, body)
+		req.Body = io.NopCloser(bytes.NewReader(chunked))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(chunked)), nil
+		}
+	}
+	return nil
+}
+
+// Presign returns rawURL signed for method in its query string, valid for expires
+func (signer *SigV4Signer) Presign(method string, rawURL string, expires time.Duration) (string, error) {
+	return signer.PresignWithContext(context.Background(), method, rawURL, expires)
+}
+
+// PresignWithContext is Presign resolving credential sources with ctx
+func (signer *SigV4Signer) PresignWithContext(ctx context.Context, method string, rawURL string, expires time.Duration) (string, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if expires <= 0 || expires > 7*24*time.Hour {
+		return "", errors.New("presigned url expiry must be between 1 second and 7 days")
+	}
+	credentials, err := signer.Credentials.resolve(ctx)
+	if err != nil {
+		return "", err
+	}
+	now := signer.time()
+
+	query := target.Query()
+	query.Set("X-Amz-Algorithm", sigV4Algorithm)
+	query.Set("X-Amz-Credential", credentials.AccessKeyID+"/"+signer.scope(now))
+	query.Set("X-Amz-Date", now.Format(sigV4TimeFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires/time.Second)))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if credentials.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", credentials.SessionToken)
+	}
+
+	// only S3 accepts an unsigned payload, other services sign the empty body
+	payload := emptySHA256
+	if signer.Service == "s3" {
+		payload = PayloadUnsigned
+	}
+	canonicalRequest := strings.Join([]string{
+		method,
+		signer.canonicalPath(target),
+		canonicalQuery(query),
+		"host:" + target.Host + "\n",
+		"host",
+		payload,
+	}, "\n")
+	query.Set("X-Amz-Signature", signer.sign(signer.signingKey(credentials, now), now, canonicalRequest))
+	target.RawQuery = canonicalQuery(query)
+	return target.String(), nil
+}
+
+func (signer *SigV4Signer) time() time.Time {
+	if signer.now != nil {
+		return signer.now().UTC()
+	}
+	return time.Now().UTC()
+}
+
+func (signer *SigV4Signer) chunkSize() int {
+	if signer.ChunkSize > 0 {
+		return signer.ChunkSize
+	}
+	return DefaultSigV4ChunkSize
+}
+
+func (signer *SigV4Signer) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + signer.Region + "/" + signer.Service + "/aws4_request"
+}
+
+// sign returns the hex signature of a canonical request
+func (signer *SigV4Signer) sign(key []byte, now time.Time, canonicalRequest string) string {
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		now.Format(sigV4TimeFormat),
+		signer.scope(now),
+		hashSHA256([]byte(canonicalRequest)),
+	}, "\n")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func (signer *SigV4Signer) signingKey(credentials AWSCredentials, now time.Time) []byte {
+	key := hmacSHA256([]byte("AWS4"+credentials.SecretAccessKey), now.Format("20060102"))
+	key = hmacSHA256(key, signer.Region)
+	key = hmacSHA256(key, signer.Service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+// chunkBody encodes body as aws-chunked, chaining each chunk signature from
+// the seed signature of the request
+func (signer *SigV4Signer) chunkBody(key []byte, now time.Time, seed string, body []byte) []byte {
+	previous := seed
+	var chunked bytes.Buffer
+	for offset := 0; ; {
+		end := offset + signer.chunkSize()
+		if end > len(body) {
+			end = len(body)
+		}
+		chunk := body[offset:end]
+		offset = end
+		stringToSign := strings.Join([]string{
+			sigV4Algorithm + "-PAYLOAD",
+			now.Format(sigV4TimeFormat),
+			signer.scope(now),
+			previous,
+			emptySHA256,
+			hashSHA256(chunk),
+		}, "\n")
+		previous = hex.EncodeToString(hmacSHA256(key, stringToSign))
+		fmt.Fprintf(&chunked, "%x;chunk-signature=%s\r\n", len(chunk), previous)
+		chunked.Write(chunk)
+		chunked.WriteString("\r\n")
+		if len(chunk) == 0 {
+			return chunked.Bytes()
+		}
+	}
+}
+
+// streamingLength is the aws-chunked length of a body of size bytes
+func streamingLength(size int, chunkSize int) int64 {
+	chunkLength := func(n int) int64 {
+		// hex size, ";chunk-signature=", 64 hex digits, two CRLFs, data
+		return int64(len(strconv.FormatInt(int64(n), 16)) + 17 + 64 + 4 + n)
+	}
+	total := int64(0)
+	for remaining := size; remaining > 0; remaining -= chunkSize {
+		if remaining < chunkSize {
+			total += chunkLength(remaining)
+		} else {
+			total += chunkLength(chunkSize)
+		}
+	}
+	return total + chunkLength(0)
+}
+
+// canonicalHeaders returns the canonical header block and signed header list
+func (signer *SigV4Signer) canonicalHeaders(req *http.Request) (string, string) {
+	values := map[string][]string{}
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	values["host"] = []string{host}
+	if signer.Payload == PayloadStreaming {
+		values["content-length"] = []string{strconv.FormatInt(req.ContentLength, 10)}
+	}
+	for key, headerValues := range req.Header {
+		name := strings.ToLower(key)
+		switch name {
+		case "authorization", "user-agent", "x-amzn-trace-id", "expect":
+			continue
+		}
+		values[name] = append(values[name], headerValues...)
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	for _, name := range names {
+		trimmed := make([]string, len(values[name]))
+		for i, value := range values[name] {
+			trimmed[i] = strings.Join(strings.Fields(value), " ")
+		}
+		canonical.WriteString(name + ":" + strings.Join(trimmed, ",") + "\n")
+	}
+	return canonical.String(), strings.Join(names, ";")
+}
+
+// canonicalPath URI-encodes each segment of the decoded path once for S3,
+// whose object keys are signed as they are, and twice for other services,
+// after removing empty and dot segments
+func (signer *SigV4Signer) canonicalPath(target *url.URL) string {
+	escaped := target.EscapedPath()
+	if escaped == "" {
+		return "/"
+	}
+	segments := strings.Split(escaped, "/")
+	for i, segment := range segments {
+		if decoded, err := url.PathUnescape(segment); err == nil {
+			segments[i] = decoded
+		}
+	}
+	if signer.Service == "s3" {
+		for i, segment := range segments {
+			segments[i] = awsURIEncode(segment)
+		}
+		return strings.Join(segments, "/")
+	}
+
+	var kept []string
+	for _, segment := range segments {
+		switch segment {
+		case "", ".":
+		case "..":
+			if len(kept) > 0 {
+				kept = kept[:len(kept)-1]
+			}
+		default:
+			kept = append(kept, awsURIEncode(awsURIEncode(segment)))
+		}
+	}
+	canonical := "/" + strings.Join(kept, "/")
+	if len(kept) > 0 && strings.HasSuffix(escaped, "/") {
+		canonical += "/"
+	}
+	return canonical
+}
+
+// canonicalQuery sorts and AWS-encodes query parameters
+func canonicalQuery(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for key, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, awsURIEncode(key)+"="+awsURIEncode(value))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// awsURIEncode percent-encodes every byte outside the unreserved set
+func awsURIEncode(value string) string {
+	var encoded strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' {
+			encoded.WriteByte(c)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", c)
+		}
+	}
+	return encoded.String()
+}
+
+// requestBody reads the body of req without consuming it
+func requestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody == nil {
+		return nil, errors.New("request body cannot be read twice for signing")
+	}
+	reader, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+func hashSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
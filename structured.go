@@ -0,0 +1,362 @@
+package webreq
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The subset of Structured Field Values (RFC 8941) used by message signatures
+// and digests: dictionaries of items and inner lists with parameters. Decimal
+// items are not supported.
+
+// sfToken is a token bare item, kept apart from strings for serialization
+type sfToken string
+
+// sfParam is a parameter of an item or inner list
+type sfParam struct {
+	name  string
+	value interface{} // string, sfToken, int64, bool or []byte
+}
+
+// sfItem is a bare item with its parameters
+type sfItem struct {
+	value  interface{}
+	params []sfParam
+}
+
+// sfMember is a dictionary member holding an item or an inner list
+type sfMember struct {
+	name   string
+	item   sfItem
+	list   []sfItem
+	isList bool
+}
+
+// param returns the value of the named parameter, or nil
+func (item sfItem) param(name string) interface{} {
+	for _, param := range item.params {
+		if param.name == name {
+			return param.value
+		}
+	}
+	return nil
+}
+
+type sfParser struct {
+	input string
+	pos   int
+}
+
+// parseSFDictionary parses a dictionary field value, combining multiple
+// field lines as RFC 8941 section 4.2 requires
+func parseSFDictionary(values []string) ([]sfMember, error) {
+	parser := &sfParser{input: strings.Join(values, ", ")}
+	var members []sfMember
+	parser.skip(" ")
+	for parser.pos < len(parser.input) {
+		name, err := parser.key()
+		if err != nil {
+			return nil, err
+		}
+		member := sfMember{name: name}
+		if parser.peek() == '=' {
+			parser.pos++
+			if parser.peek() == '(' {
+				member.isList = true
+				member.list, member.item.params, err = parser.innerList()
+			} else {
+				member.item, err = parser.item()
+			}
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			member.item.value = true
+			if member.item.params, err = parser.params(); err != nil {
+				return nil, err
+			}
+		}
+		// a later member of the same name replaces the earlier one
+		for i := range members {
+			if members[i].name == name {
+				members = append(members[:i], members[i+1:]...)
+				break
+			}
+		}
+		members = append(members, member)
+
+		parser.skip(" \t")
+		if parser.pos == len(parser.input) {
+			break
+		}
+		if parser.peek() != ',' {
+			return nil, parser.errorf("expected comma")
+		}
+		parser.pos++
+		parser.skip(" \t")
+		if parser.pos == len(parser.input) {
+			return nil, parser.errorf("trailing comma")
+		}
+	}
+	return members, nil
+}
+
+// parseSFItem parses a single item, such as a component identifier
+func parseSFItem(value string) (sfItem, error) {
+	parser := &sfParser{input: value}
+	parser.skip(" ")
+	item, err := parser.item()
+	if err != nil {
+		return sfItem{}, err
+	}
+	parser.skip(" ")
+	if parser.pos != len(parser.input) {
+		return sfItem{}, parser.errorf("unexpected trailing characters")
+	}
+	return item, nil
+}
+
+func (parser *sfParser) peek() byte {
+	if parser.pos < len(parser.input) {
+		return parser.input[parser.pos]
+	}
+	return 0
+}
+
+func (parser *sfParser) skip(chars string) {
+	for parser.pos < len(parser.input) && strings.IndexByte(chars, parser.input[parser.pos]) >= 0 {
+		parser.pos++
+	}
+}
+
+func (parser *sfParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid structured field at offset %d: %s", parser.pos, fmt.Sprintf(format, args...))
+}
+
+func (parser *sfParser) innerList() ([]sfItem, []sfParam, error) {
+	parser.pos++ // (
+	var items []sfItem
+	for {
+		parser.skip(" ")
+		if parser.pos == len(parser.input) {
+			return nil, nil, parser.errorf("unterminated inner list")
+		}
+		if parser.peek() == ')' {
+			parser.pos++
+			params, err := parser.params()
+			return items, params, err
+		}
+		item, err := parser.item()
+		if err != nil {
+			return nil, nil, err
+		}
+		items = append(items, item)
+		if c := parser.peek(); c != ' ' && c != ')' {
+			return nil, nil, parser.errorf("expected space or ) in inner list")
+		}
+	}
+}
+
+func (parser *sfParser) item() (sfItem, error) {
+	value, err := parser.bareItem()
+	if err != nil {
+		return sfItem{}, err
+	}
+	params, err := parser.params()
+	return sfItem{value: value, params: params}, err
+}
+
+func (parser *sfParser) params() ([]sfParam, error) {
+	var params []sfParam
+	for parser.peek() == ';' {
+		parser.pos++
+		parser.skip(" ")
+		name, err := parser.key()
+		if err != nil {
+			return nil, err
+		}
+		var value interface{} = true
+		if parser.peek() == '=' {
+			parser.pos++
+			if value, err = parser.bareItem(); err != nil {
+				return nil, err
+			}
+		}
+		replaced := false
+		for i := range params {
+			if params[i].name == name {
+				params[i].value = value
+				replaced = true
+			}
+		}
+		if !replaced {
+			params = append(params, sfParam{name: name, value: value})
+		}
+	}
+	return params, nil
+}
+
+func (parser *sfParser) key() (string, error) {
+	start := parser.pos
+	if c := parser.peek(); !(c >= 'a' && c <= 'z') && c != '*' {
+		return "", parser.errorf("invalid key")
+	}
+	for parser.pos < len(parser.input) {
+		c := parser.input[parser.pos]
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || strings.IndexByte("_-.*", c) >= 0 {
+			parser.pos++
+			continue
+		}
+		break
+	}
+	return parser.input[start:parser.pos], nil
+}
+
+func (parser *sfParser) bareItem() (interface{}, error) {
+	c := parser.peek()
+	switch {
+	case c == '"':
+		return parser.string()
+	case c == ':':
+		return parser.byteSequence()
+	case c == '?':
+		parser.pos++
+		switch parser.peek() {
+		case '1':
+			parser.pos++
+			return true, nil
+		case '0':
+			parser.pos++
+			return false, nil
+		}
+		return nil, parser.errorf("invalid boolean")
+	case c == '-' || (c >= '0' && c <= '9'):
+		return parser.integer()
+	case (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '*':
+		return parser.token(), nil
+	}
+	return nil, parser.errorf("unexpected character %q", c)
+}
+
+func (parser *sfParser) string() (string, error) {
+	parser.pos++ // opening quote
+	var builder strings.Builder
+	for parser.pos < len(parser.input) {
+		c := parser.input[parser.pos]
+		parser.pos++
+		switch {
+		case c == '\\':
+			if parser.pos == len(parser.input) {
+				return "", parser.errorf("unterminated string")
+			}
+			next := parser.input[parser.pos]
+			if next != '"' && next != '\\' {
+				return "", parser.errorf("invalid escape")
+			}
+			builder.WriteByte(next)
+			parser.pos++
+		case c == '"':
+			return builder.String(), nil
+		case c < 0x20 || c > 0x7e:
+			return "", parser.errorf("invalid character in string")
+		default:
+			builder.WriteByte(c)
+		}
+	}
+	return "", parser.errorf("unterminated string")
+}
+
+func (parser *sfParser) byteSequence() ([]byte, error) {
+	parser.pos++ // opening colon
+	end := strings.IndexByte(parser.input[parser.pos:], ':')
+	if end < 0 {
+		return nil, parser.errorf("unterminated byte sequence")
+	}
+	encoded := parser.input[parser.pos : parser.pos+end]
+	parser.pos += end + 1
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		// RFC 8941 asks parsers to tolerate missing padding
+		if decoded, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(encoded, "=")); err != nil {
+			return nil, parser.errorf("invalid byte sequence")
+		}
+	}
+	return decoded, nil
+}
+
+func (parser *sfParser) integer() (int64, error) {
+	start := parser.pos
+	if parser.peek() == '-' {
+		parser.pos++
+	}
+	for parser.pos < len(parser.input) && parser.input[parser.pos] >= '0' && parser.input[parser.pos] <= '9' {
+		parser.pos++
+	}
+	if parser.peek() == '.' {
+		return 0, parser.errorf("decimals are not supported")
+	}
+	digits := parser.input[start:parser.pos]
+	if len(strings.TrimPrefix(digits, "-")) == 0 || len(strings.TrimPrefix(digits, "-")) > 15 {
+		return 0, parser.errorf("invalid integer")
+	}
+	return strconv.ParseInt(digits, 10, 64)
+}
+
+func (parser *sfParser) token() sfToken {
+	start := parser.pos
+	for parser.pos < len(parser.input) {
+		c := parser.input[parser.pos]
+		if c > 0x20 && c < 0x7f && strings.IndexByte(`"(),;<=>?@[\]{}`, c) < 0 {
+			parser.pos++
+			continue
+		}
+		break
+	}
+	return sfToken(parser.input[start:parser.pos])
+}
+
+// serializeSFItem serializes an item with its parameters
+func serializeSFItem(item sfItem) string {
+	return serializeSFBare(item.value) + serializeSFParams(item.params)
+}
+
+// serializeSFInnerList serializes an inner list with its parameters
+func serializeSFInnerList(items []sfItem, params []sfParam) string {
+	serialized := make([]string, len(items))
+	for i, item := range items {
+		serialized[i] = serializeSFItem(item)
+	}
+	return "(" + strings.Join(serialized, " ") + ")" + serializeSFParams(params)
+}
+
+func serializeSFParams(params []sfParam) string {
+	var builder strings.Builder
+	for _, param := range params {
+		builder.WriteString(";" + param.name)
+		if value, ok := param.value.(bool); !ok || !value {
+			builder.WriteString("=" + serializeSFBare(param.value))
+		}
+	}
+	return builder.String()
+}
+
+func serializeSFBare(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+	case sfToken:
+		return string(value)
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case bool:
+		if value {
+			return "?1"
+		}
+		return "?0"
+	case []byte:
+		return ":" + base64.StdEncoding.EncodeToString(value) + ":"
+	}
+	return ""
+}
@@ -0,0 +1,117 @@
+package webreq
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// transferRateBuckets is how many slices the sliding window is measured in
+	transferRateBuckets = 4
+	// minTransferRateWindow is the shortest window measured, so every bucket
+	// spans at least 25ms
+	minTransferRateWindow = transferRateBuckets * 25 * time.Millisecond
+)
+
+// TransferRate is the minimum amount of response body that must arrive in
+// any Window once the body starts, protecting workers from servers that
+// trickle data to hold connections open (slow loris).
+type TransferRate struct {
+	Bytes int64
+	// Window must be positive, windows under 100ms are raised to 100ms
+	Window time.Duration
+}
+
+// newTransferRate creates a TransferRate, raising short windows to the minimum
+func newTransferRate(bytes int64, window time.Duration) *TransferRate {
+	if window < minTransferRateWindow {
+		window = minTransferRateWindow
+	}
+	return &TransferRate{Bytes: bytes, Window: window}
+}
+
+// validate rejects rates that cannot be measured
+func (rate *TransferRate) validate() error {
+	if rate.Window <= 0 {
+		return errors.New("minimum transfer rate window must be positive")
+	}
+	return nil
+}
+
+// rateMonitor counts body bytes and aborts the execution when the last
+// Window saw fewer than Bytes
+type rateMonitor struct {
+	// bytes is updated atomically, so it comes first to stay 64-bit aligned
+	// on 32-bit platforms
+	bytes int64
+	rate  TransferRate
+	dog   *watchdog
+	done  chan struct{}
+}
+
+func newRateMonitor(rate TransferRate, dog *watchdog) *rateMonitor {
+	// time.NewTicker panics on a zero interval
+	if rate.Window < minTransferRateWindow {
+		rate.Window = minTransferRateWindow
+	}
+	monitor := &rateMonitor{
+		rate: rate,
+		dog:  dog,
+		done: make(chan struct{}),
+	}
+	go monitor.run()
+	return monitor
+}
+
+func (monitor *rateMonitor) run() {
+	ticker := time.NewTicker(monitor.rate.Window / transferRateBuckets)
+	defer ticker.Stop()
+
+	var buckets [transferRateBuckets]int64
+	var previous int64
+	ticks := 0
+	for {
+		select {
+		case <-monitor.done:
+			return
+		case <-ticker.C:
+			total := atomic.LoadInt64(&monitor.bytes)
+			buckets[ticks%transferRateBuckets] = total - previous
+			previous = total
+			ticks++
+			if ticks < transferRateBuckets {
+				continue
+			}
+			var received int64
+			for _, bucket := range buckets {
+				received += bucket
+			}
+			if received < monitor.rate.Bytes {
+				monitor.dog.fire(TimeoutPhaseTransferRate, monitor.rate.Window)
+				return
+			}
+		}
+	}
+}
+
+func (monitor *rateMonitor) stop() {
+	close(monitor.done)
+}
+
+// reader counts the bytes read through it
+func (monitor *rateMonitor) reader(reader io.Reader) io.Reader {
+	return &countingReader{reader: reader, count: &monitor.bytes}
+}
+
+type countingReader struct {
+	reader io.Reader
+	count  *int64
+}
+
+func (counting *countingReader) Read(p []byte) (int, error) {
+	n, err := counting.reader.Read(p)
+	atomic.AddInt64(counting.count, int64(n))
+	return n, err
+}
@@ -0,0 +1,189 @@
+package webreq
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+const (
+	TimeoutPhaseDial           = "dial"
+	TimeoutPhaseTLSHandshake   = "tls handshake"
+	TimeoutPhaseResponseHeader = "response header"
+	TimeoutPhaseBodyIdle       = "body idle"
+	TimeoutPhaseOverall        = "overall"
+	TimeoutPhaseTransferRate   = "transfer rate"
+)
+
+// Timeouts bounds each phase of a request separately. Zero values leave a
+// phase unbounded, and Request values take precedence over Client values.
+type Timeouts struct {
+	Dial           time.Duration // DNS lookup and TCP connect
+	TLSHandshake   time.Duration
+	ResponseHeader time.Duration // from the request being written to the first response byte
+	BodyIdle       time.Duration // longest wait for a single read of the response body
+	Overall        time.Duration // whole execution, replaces TimeoutDuration in Execute
+}
+
+// merge returns timeouts with zero fields filled from fallback
+func (timeouts Timeouts) merge(fallback Timeouts) Timeouts {
+	if timeouts.Dial == 0 {
+		timeouts.Dial = fallback.Dial
+	}
+	if timeouts.TLSHandshake == 0 {
+		timeouts.TLSHandshake = fallback.TLSHandshake
+	}
+	if timeouts.ResponseHeader == 0 {
+		timeouts.ResponseHeader = fallback.ResponseHeader
+	}
+	if timeouts.BodyIdle == 0 {
+		timeouts.BodyIdle = fallback.BodyIdle
+	}
+	if timeouts.Overall == 0 {
+		timeouts.Overall = fallback.Overall
+	}
+	return timeouts
+}
+
+// TimeoutError reports which phase of a request ran out of time
+type TimeoutError struct {
+	Phase string
+	Limit time.Duration
+	Err   error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timeout after %s: %v", e.Phase, e.Limit, e.Err)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout reports true, so TimeoutError satisfies net.Error checks
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// watchdog cancels an execution when one of its phase timers fires and
+// remembers which phase it was
+type watchdog struct {
+	timeouts Timeouts
+	cancel   context.CancelFunc
+
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+	fired  *TimeoutError
+}
+
+type watchdogKey struct{}
+
+// newWatchdog derives a cancellable context carrying the watchdog
+func newWatchdog(ctx context.Context, timeouts Timeouts) (context.Context, *watchdog) {
+	ctx, cancel := context.WithCancel(ctx)
+	dog := &watchdog{
+		timeouts: timeouts,
+		cancel:   cancel,
+		timers:   make(map[string]*time.Timer),
+	}
+	return context.WithValue(ctx, watchdogKey{}, dog), dog
+}
+
+func watchdogFrom(ctx context.Context) *watchdog {
+	dog, _ := ctx.Value(watchdogKey{}).(*watchdog)
+	return dog
+}
+
+// start arms the timer of phase, replacing a running one
+func (dog *watchdog) start(phase string, timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	dog.mu.Lock()
+	defer dog.mu.Unlock()
+	if timer, ok := dog.timers[phase]; ok {
+		timer.Stop()
+	}
+	dog.timers[phase] = time.AfterFunc(timeout, func() {
+		dog.fire(phase, timeout)
+	})
+}
+
+// fire cancels the execution, blaming phase unless another phase fired first
+func (dog *watchdog) fire(phase string, limit time.Duration) {
+	dog.mu.Lock()
+	if dog.fired == nil {
+		dog.fired = &TimeoutError{Phase: phase, Limit: limit}
+	}
+	dog.mu.Unlock()
+	dog.cancel()
+}
+
+// stop disarms the timer of phase
+func (dog *watchdog) stop(phase string) {
+	dog.mu.Lock()
+	defer dog.mu.Unlock()
+	if timer, ok := dog.timers[phase]; ok {
+		timer.Stop()
+		delete(dog.timers, phase)
+	}
+}
+
+// close disarms every timer and releases the context
+func (dog *watchdog) close() {
+	dog.mu.Lock()
+	for phase, timer := range dog.timers {
+		timer.Stop()
+		delete(dog.timers, phase)
+	}
+	dog.mu.Unlock()
+	dog.cancel()
+}
+
+// wrap turns err into a TimeoutError when a phase timer caused it
+func (dog *watchdog) wrap(err error) error {
+	if err == nil {
+		return nil
+	}
+	dog.mu.Lock()
+	defer dog.mu.Unlock()
+	if dog.fired == nil {
+		return err
+	}
+	return &TimeoutError{Phase: dog.fired.Phase, Limit: dog.fired.Limit, Err: err}
+}
+
+// trace times the TLS handshake and the wait for the response header
+func (dog *watchdog) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		TLSHandshakeStart: func() {
+			dog.start(TimeoutPhaseTLSHandshake, dog.timeouts.TLSHandshake)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			dog.stop(TimeoutPhaseTLSHandshake)
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			dog.start(TimeoutPhaseResponseHeader, dog.timeouts.ResponseHeader)
+		},
+		GotFirstResponseByte: func() {
+			dog.stop(TimeoutPhaseResponseHeader)
+		},
+	}
+}
+
+// idleReader rearms the body idle timer around every read
+type idleReader struct {
+	reader io.Reader
+	dog    *watchdog
+}
+
+func (idle *idleReader) Read(p []byte) (int, error) {
+	idle.dog.start(TimeoutPhaseBodyIdle, idle.dog.timeouts.BodyIdle)
+	n, err := idle.reader.Read(p)
+	idle.dog.stop(TimeoutPhaseBodyIdle)
+	return n, err
+}
@@ -0,0 +1,160 @@
+package webreq
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timings breaks down where the time of an execution went. Phases are summed
+// over every attempt of the execution, including redirects and
+// authentication retries, and are zero when a phase did not happen, such as
+// DNS and connect on a reused connection.
+type Timings struct {
+	DNSLookup    time.Duration
+	Connect      time.Duration // TCP or unix socket connect
+	TLSHandshake time.Duration
+	// TimeToFirstByte is the server time, from the request being written to
+	// the first byte of the response
+	TimeToFirstByte time.Duration
+	// BodyTransfer is the time from the first byte of the final response to
+	// the end of its body
+	BodyTransfer time.Duration
+	Total        time.Duration
+	// ConnectionReused reports whether the final response came over a
+	// connection from the pool
+	ConnectionReused bool
+	RemoteAddr       string // address of the final connection
+}
+
+// TimingStats aggregates the Timings of the requests executed through a Client
+type TimingStats struct {
+	Requests          int64
+	ReusedConnections int64
+	DNSLookup         time.Duration
+	Connect           time.Duration
+	TLSHandshake      time.Duration
+	TimeToFirstByte   time.Duration
+	BodyTransfer      time.Duration
+	Total             time.Duration
+}
+
+// Average returns the mean Timings of the aggregated requests
+func (stats TimingStats) Average() Timings {
+	if stats.Requests == 0 {
+		return Timings{}
+	}
+	n := time.Duration(stats.Requests)
+	return Timings{
+		DNSLookup:       stats.DNSLookup / n,
+		Connect:         stats.Connect / n,
+		TLSHandshake:    stats.TLSHandshake / n,
+		TimeToFirstByte: stats.TimeToFirstByte / n,
+		BodyTransfer:    stats.BodyTransfer / n,
+		Total:           stats.Total / n,
+	}
+}
+
+// add aggregates the timings of one request
+func (stats *TimingStats) add(timings Timings) {
+	stats.Requests++
+	if timings.ConnectionReused {
+		stats.ReusedConnections++
+	}
+	stats.DNSLookup += timings.DNSLookup
+	stats.Connect += timings.Connect
+	stats.TLSHandshake += timings.TLSHandshake
+	stats.TimeToFirstByte += timings.TimeToFirstByte
+	stats.BodyTransfer += timings.BodyTransfer
+	stats.Total += timings.Total
+}
+
+// timingTrace records the phases of an execution from httptrace hooks
+type timingTrace struct {
+	mu       sync.Mutex
+	timings  Timings
+	start    time.Time
+	dnsStart time.Time
+	connect  time.Time
+	tls      time.Time
+	wrote    time.Time
+	first    time.Time
+}
+
+func newTimingTrace() *timingTrace {
+	return &timingTrace{start: time.Now()}
+}
+
+// trace returns the hooks recording the phases. Starts that are already
+// open are kept, so nested lookups, such as a caching Resolver over the
+// system resolver, are counted once.
+func (timing *timingTrace) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			timing.mu.Lock()
+			defer timing.mu.Unlock()
+			timing.timings.ConnectionReused = info.Reused
+			if info.Conn != nil {
+				timing.timings.RemoteAddr = info.Conn.RemoteAddr().String()
+			}
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			timing.begin(&timing.dnsStart)
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			timing.end(&timing.dnsStart, &timing.timings.DNSLookup)
+		},
+		ConnectStart: func(string, string) {
+			timing.begin(&timing.connect)
+		},
+		ConnectDone: func(string, string, error) {
+			timing.end(&timing.connect, &timing.timings.Connect)
+		},
+		TLSHandshakeStart: func() {
+			timing.begin(&timing.tls)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			timing.end(&timing.tls, &timing.timings.TLSHandshake)
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			timing.begin(&timing.wrote)
+		},
+		GotFirstResponseByte: func() {
+			timing.mu.Lock()
+			timing.first = time.Now()
+			timing.mu.Unlock()
+			timing.end(&timing.wrote, &timing.timings.TimeToFirstByte)
+		},
+	}
+}
+
+func (timing *timingTrace) begin(start *time.Time) {
+	timing.mu.Lock()
+	defer timing.mu.Unlock()
+	if start.IsZero() {
+		*start = time.Now()
+	}
+}
+
+func (timing *timingTrace) end(start *time.Time, total *time.Duration) {
+	timing.mu.Lock()
+	defer timing.mu.Unlock()
+	if !start.IsZero() {
+		*total += time.Since(*start)
+		*start = time.Time{}
+	}
+}
+
+// finish returns the timings of an execution whose body was just read
+func (timing *timingTrace) finish() Timings {
+	timing.mu.Lock()
+	defer timing.mu.Unlock()
+	now := time.Now()
+	timings := timing.timings
+	if !timing.first.IsZero() {
+		timings.BodyTransfer = now.Sub(timing.first)
+	}
+	timings.Total = now.Sub(timing.start)
+	return timings
+}
@@ -0,0 +1,211 @@
+package webreq
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// ClientCertificateSource supplies the client certificate at handshake time,
+// such as a CertificateWatcher following rotated files
+type ClientCertificateSource interface {
+	GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error)
+}
+
+// TLSConfig holds the TLS settings of a Client
+type TLSConfig struct {
+	RootCAs            []*x509.Certificate     // trusted roots; empty uses the system pool
+	IncludeSystemRoots bool                    // also trust the system pool, when it can be loaded
+	Certificates       []tls.Certificate       // client certificates for mTLS
+	CertificateSource  ClientCertificateSource // takes precedence over Certificates
+	MinVersion         uint16                  // defaults to TLS 1.2
+	CipherSuites       []uint16                // TLS 1.2 and earlier only, Go picks TLS 1.3 suites
+	ServerName         string                  // overrides SNI and the name verified in the certificate
+	Pins               map[string][]string     // SPKI pins per host, see AddPin
+	PinReportOnly      bool
+	OnPinMismatch      func(*PinningError)
+
+	insecureSkipVerify bool
+}
+
+// NewTLSConfig creates a TLSConfig requiring at least TLS 1.2
+func NewTLSConfig() *TLSConfig {
+	return &TLSConfig{
+		MinVersion: tls.VersionTLS12,
+	}
+}
+
+// AddRootCAPEM trusts every certificate in the PEM data
+func (config *TLSConfig) AddRootCAPEM(data []byte) error {
+	certificates, err := parseCertificatesPEM(data)
+	if err != nil {
+		return err
+	}
+	config.RootCAs = append(config.RootCAs, certificates...)
+	return nil
+}
+
+// AddRootCAFile trusts every certificate in a PEM file
+func (config *TLSConfig) AddRootCAFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := config.AddRootCAPEM(data); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// AddRootCADir trusts the certificates of every .pem, .crt and .cer file in dir
+func (config *TLSConfig) AddRootCADir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	loaded := 0
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".pem", ".crt", ".cer":
+		default:
+			continue
+		}
+		if err := config.AddRootCAFile(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+		loaded++
+	}
+	if loaded == 0 {
+		return fmt.Errorf("no certificate files found in %s", dir)
+	}
+	return nil
+}
+
+// LoadClientCertificate adds a client certificate from PEM encoded certificate and key files
+func (config *TLSConfig) LoadClientCertificate(certFile string, keyFile string) error {
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	config.Certificates = append(config.Certificates, certificate)
+	return nil
+}
+
+// LoadClientCertificatePKCS12 adds a client certificate, with the chain
+// bundled alongside it, from a PKCS#12 (.p12/.pfx) file
+func (config *TLSConfig) LoadClientCertificatePKCS12(path string, password string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	key, leaf, chain, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	certificate := tls.Certificate{
+		Certificate: [][]byte{leaf.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+	for _, ca := range chain {
+		certificate.Certificate = append(certificate.Certificate, ca.Raw)
+	}
+	config.Certificates = append(config.Certificates, certificate)
+	return nil
+}
+
+// SetClientCertificateSource sets where the client certificate is read from on every handshake
+func (config *TLSConfig) SetClientCertificateSource(source ClientCertificateSource) *TLSConfig {
+	config.CertificateSource = source
+	return config
+}
+
+// SetMinVersion sets the minimum TLS version, such as tls.VersionTLS13
+func (config *TLSConfig) SetMinVersion(version uint16) *TLSConfig {
+	config.MinVersion = version
+	return config
+}
+
+// SetCipherSuites restricts the TLS 1.2 cipher suites offered
+func (config *TLSConfig) SetCipherSuites(suites ...uint16) *TLSConfig {
+	config.CipherSuites = suites
+	return config
+}
+
+// SetServerName overrides the server name sent in SNI and verified in the certificate
+func (config *TLSConfig) SetServerName(name string) *TLSConfig {
+	config.ServerName = name
+	return config
+}
+
+// DangerouslySkipCertificateVerification disables verification of the server
+// certificate chain and host name. Anyone on the network path can then read
+// and modify the traffic; only use it against test servers.
+func (config *TLSConfig) DangerouslySkipCertificateVerification() *TLSConfig {
+	config.insecureSkipVerify = true
+	return config
+}
+
+// build creates the crypto/tls configuration
+func (config *TLSConfig) build() *tls.Config {
+	tlsConfig := &tls.Config{
+		Certificates:       config.Certificates,
+		MinVersion:         config.MinVersion,
+		CipherSuites:       config.CipherSuites,
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.insecureSkipVerify,
+	}
+	if len(config.RootCAs) > 0 {
+		pool := x509.NewCertPool()
+		if config.IncludeSystemRoots {
+			if system, err := x509.SystemCertPool(); err == nil {
+				pool = system
+			}
+		}
+		for _, certificate := range config.RootCAs {
+			pool.AddCert(certificate)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if config.CertificateSource != nil {
+		tlsConfig.GetClientCertificate = config.CertificateSource.GetClientCertificate
+	}
+	if len(config.Pins) > 0 {
+		tlsConfig.VerifyConnection = config.verifyConnection
+	}
+	return tlsConfig
+}
+
+// parseCertificatesPEM returns every CERTIFICATE block in data
+func parseCertificatesPEM(data []byte) ([]*x509.Certificate, error) {
+	var certificates []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, certificate)
+	}
+	if len(certificates) == 0 {
+		return nil, errors.New("no PEM certificates found")
+	}
+	return certificates, nil
+}
@@ -0,0 +1,112 @@
+package webreq
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SchemeHTTPUnix addresses a Unix domain socket in the URL itself, with the
+// socket path percent-encoded as the host:
+//
+//	http+unix://%2Fvar%2Frun%2Fdocker.sock/v1.43/containers/json
+//
+// net/url rejects escaped slashes in hosts, so Request rewrites the host to a
+// hex encoding of the socket path before sending. These URLs are only served
+// by Clients with SetUnixSocketURLs or SetUnixSocket, and redirects to them
+// are always refused.
+const SchemeHTTPUnix = "http+unix"
+
+// unixHost is the Host header sent over Unix sockets
+const unixHost = "localhost"
+
+// unixTransport serves http+unix URLs with one pooled transport per socket
+type unixTransport struct {
+	mu         sync.Mutex
+	transports map[string]*http.Transport
+}
+
+func newUnixTransport() *unixTransport {
+	return &unixTransport{transports: make(map[string]*http.Transport)}
+}
+
+// RoundTrip sends req to the socket named by its host
+func (unix *unixTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	decoded, err := hex.DecodeString(req.URL.Host)
+	if err != nil || len(decoded) == 0 {
+		return nil, fmt.Errorf("invalid unix socket host %q", req.URL.Host)
+	}
+	socket := string(decoded)
+
+	unix.mu.Lock()
+	transport, ok := unix.transports[socket]
+	if !ok {
+		transport = &http.Transport{
+			DialContext:     unixDialer(socket),
+			MaxIdleConns:    10,
+			IdleConnTimeout: 90 * time.Second,
+		}
+		unix.transports[socket] = transport
+	}
+	unix.mu.Unlock()
+
+	outgoing := req.Clone(req.Context())
+	outgoing.URL.Scheme = "http"
+	outgoing.URL.Host = unixHost
+	outgoing.Host = unixHost
+	return transport.RoundTrip(outgoing)
+}
+
+// unixDialer returns a DialContext that always connects to socket
+func unixDialer(socket string) func(ctx context.Context, network string, address string) (net.Conn, error) {
+	var dialer net.Dialer
+	return func(ctx context.Context, network string, address string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "unix", socket)
+	}
+}
+
+// UnixSocketURL builds an http+unix URL for path on the given socket
+func UnixSocketURL(socket string, path string) string {
+	return SchemeHTTPUnix + "://" + url.PathEscape(socket) + path
+}
+
+// unixSocketURL rewrites the percent-encoded socket host of an http+unix URL
+// into the hex form understood by unixTransport, leaving other URLs untouched
+func unixSocketURL(rawURL string) (string, error) {
+	if !isUnixSocketURL(rawURL) {
+		return rawURL, nil
+	}
+	prefix := SchemeHTTPUnix + "://"
+	rest := rawURL[len(prefix):]
+	end := strings.IndexAny(rest, "/?#")
+	if end < 0 {
+		end = len(rest)
+	}
+	socket, err := url.PathUnescape(rest[:end])
+	if err != nil || socket == "" {
+		// a *url.Error so the URL is redacted like any other
+		return "", &url.Error{Op: "parse", URL: rawURL, Err: errors.New("invalid unix socket")}
+	}
+	return prefix + hex.EncodeToString([]byte(socket)) + rest[end:], nil
+}
+
+// isUnixSocketURL reports whether rawURL uses the http+unix scheme
+func isUnixSocketURL(rawURL string) bool {
+	prefix := SchemeHTTPUnix + "://"
+	return len(rawURL) >= len(prefix) && strings.EqualFold(rawURL[:len(prefix)], prefix)
+}
+
+// checkUnixSocketURL refuses http+unix URLs unless client opted in to them
+func checkUnixSocketURL(client *Client, rawURL string) error {
+	if isUnixSocketURL(rawURL) && (client == nil || !client.unixSocketURLs()) {
+		return fmt.Errorf("%s URLs need a Client with SetUnixSocketURLs", SchemeHTTPUnix)
+	}
+	return nil
+}
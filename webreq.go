@@ -5,6 +5,7 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"net/http/httptrace"
 	"sync"
 	"time"
 )
@@ -25,13 +26,17 @@ var (
 // getDefaultClient returns a shared HTTP client with optimized transport settings
 func getDefaultClient() *http.Client {
 	defaultClientOnce.Do(func() {
+		netDialer := newNetDialer()
 		transport := &http.Transport{
 			MaxIdleConns:        100,
 			MaxIdleConnsPerHost: 10,
 			IdleConnTimeout:     90 * time.Second,
+			Proxy:               http.ProxyFromEnvironment,
+			DialContext:         dialWithTimeout(netDialer.DialContext),
 		}
 		defaultClient = &http.Client{
-			Transport: transport,
+			Transport:     transport,
+			CheckRedirect: checkRedirect,
 		}
 	})
 	return defaultClient
@@ -71,6 +76,15 @@ type Request struct {
 	StatusCode      int
 	ErrorMessage    string
 	MaxResponseSize int64 // Maximum size for response body in bytes
+	Client          *Client
+	Compression     *Compression
+	RedirectPolicy  *RedirectPolicy
+	Response        *Response // details of the last execution
+	Timeouts        *Timeouts
+	MinTransferRate *TransferRate
+	Auth            Authenticator
+	// SignatureVerifier, when set, verifies the signatures of the response
+	SignatureVerifier *MessageVerifier
 }
 
 // NewRequest creates a new Request with the specified method
@@ -108,6 +122,51 @@ func (request *Request) SetMaxResponseSize(size int64) *Request {
 	return request
 }
 
+// SetClient sets the Client used to execute the request
+func (request *Request) SetClient(client *Client) *Request {
+	request.Client = client
+	return request
+}
+
+// SetCompression sets the compression applied to the request body.
+func (request *Request) SetCompression(compression *Compression) *Request {
+	request.Compression = compression
+	return request
+}
+
+// SetRedirectPolicy sets the policy applied to redirects followed by the request
+func (request *Request) SetRedirectPolicy(policy *RedirectPolicy) *Request {
+	request.RedirectPolicy = policy
+	return request
+}
+
+// SetTimeouts sets per-phase timeouts for the request
+func (request *Request) SetTimeouts(timeouts Timeouts) *Request {
+	request.Timeouts = &timeouts
+	return request
+}
+
+// SetAuth sets the Authenticator applied to the request, overriding the Client's
+func (request *Request) SetAuth(auth Authenticator) *Request {
+	request.Auth = auth
+	return request
+}
+
+// SetSignatureVerifier verifies the HTTP message signatures of the response
+func (request *Request) SetSignatureVerifier(verifier *MessageVerifier) *Request {
+	request.SignatureVerifier = verifier
+	return request
+}
+
+// SetMinTransferRate aborts the response body when fewer than bytes arrive within
+// any window, windows under 100ms are raised to 100ms
+func (request *Request) SetMinTransferRate(bytes int64, window time.Duration) *Request {
+	if bytes > 0 && window > 0 {
+		request.MinTransferRate = newTransferRate(bytes, window)
+	}
+	return request
+}
+
 // SetHeaders sets the headers of the request
 func (request *Request) SetHeaders(headers HeadersMap) *Request {
 	if len(headers) > 0 {
@@ -163,42 +222,237 @@ func (request *Request) Check() error {
 
 // Execute sends the request and returns the response body and error if any
 func (request *Request) Execute() ([]byte, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), request.TimeoutDuration)
-	defer cancel()
-	return request.ExecuteWithContext(ctx)
+	overall := request.TimeoutDuration
+	if timeouts := request.timeouts(); timeouts.Overall > 0 {
+		overall = timeouts.Overall
+	}
+	return request.execute(context.Background(), overall)
 }
 
 // ExecuteWithContext sends the request with a custom context and returns the response body and error if any
 func (request *Request) ExecuteWithContext(ctx context.Context) ([]byte, error) {
-	client := getDefaultClient()
+	return request.execute(ctx, request.timeouts().Overall)
+}
 
-	var body io.Reader
-	if len(request.Data) > 0 {
-		body = bytes.NewReader(request.Data)
+// execute sends the request, bounding the whole execution by overall when positive
+func (request *Request) execute(ctx context.Context, overall time.Duration) ([]byte, error) {
+	caller := ctx
+	if overall > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, overall)
+		defer cancel()
 	}
+	parent := ctx
 
-	webRequest, err := http.NewRequestWithContext(ctx, request.Method, request.URL, body)
+	ctx, dog := newWatchdog(ctx, request.timeouts())
+	defer dog.close()
+	ctx = httptrace.WithClientTrace(ctx, dog.trace())
+	timing := newTimingTrace()
+	ctx = httptrace.WithClientTrace(ctx, timing.trace())
+
+	body, err := request.send(ctx, dog, timing)
+	// errors from parsing, policies and the transport may all carry the URL
+	err = request.redactor().Error(err)
+	// the overall timer fired only if the caller's context is still live,
+	// a shorter caller deadline is reported as the caller's error
+	if err != nil && overall > 0 && parent.Err() == context.DeadlineExceeded && caller.Err() == nil {
+		return nil, &TimeoutError{Phase: TimeoutPhaseOverall, Limit: overall, Err: err}
+	}
+	return body, dog.wrap(err)
+}
+
+// send performs the HTTP exchange and reads the response body
+func (request *Request) send(ctx context.Context, dog *watchdog, timing *timingTrace) ([]byte, error) {
+	client := getDefaultClient()
+	if request.Client != nil {
+		client = request.Client.HTTPClient()
+	}
+
+	data, encoding, err := request.encodeData()
 	if err != nil {
 		return nil, err
 	}
+	if rate := request.minTransferRate(); rate != nil {
+		if err := rate.validate(); err != nil {
+			return nil, err
+		}
+	}
 
-	for key, value := range request.Headers {
-		webRequest.Header.Add(key, value)
+	redirects := &redirectState{policy: request.RedirectPolicy}
+	if redirects.policy == nil && request.Client != nil {
+		redirects.policy = request.Client.RedirectPolicy
 	}
+	ctx = withRedirectState(ctx, redirects)
 
-	response, err := client.Do(webRequest)
+	if err := checkUnixSocketURL(request.Client, request.URL); err != nil {
+		return nil, err
+	}
+	target, err := unixSocketURL(request.URL)
 	if err != nil {
 		return nil, err
 	}
+
+	auth := request.authenticator()
+	response, err := request.do(ctx, client, target, data, encoding, auth)
+	if err != nil {
+		return nil, err
+	}
+	if retry, ok := auth.(RetryAuthenticator); ok && response.StatusCode == http.StatusUnauthorized && retry.Invalidate(ctx, response) {
+		_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 4096))
+		response.Body.Close()
+		redirects.redirects = nil
+		response, err = request.do(ctx, client, target, data, encoding, auth)
+		if err != nil {
+			return nil, err
+		}
+	}
 	defer response.Body.Close()
 
+	var bodyReader io.Reader = &idleReader{reader: response.Body, dog: dog}
+	if rate := request.minTransferRate(); rate != nil {
+		monitor := newRateMonitor(*rate, dog)
+		defer monitor.stop()
+		bodyReader = monitor.reader(bodyReader)
+	}
+
 	// Limit response body size to prevent memory exhaustion attacks
-	limitedReader := io.LimitReader(response.Body, request.MaxResponseSize)
+	limitedReader := io.LimitReader(bodyReader, request.MaxResponseSize)
 	responseBody, err := io.ReadAll(limitedReader)
 	if err != nil {
 		return nil, err
 	}
 
 	request.StatusCode = response.StatusCode
+	request.Response = &Response{
+		StatusCode: response.StatusCode,
+		Header:     response.Header,
+		Redirects:  redirects.redirects,
+		Timings:    timing.finish(),
+	}
+	if request.Client != nil {
+		request.Client.recordTimings(request.Response.Timings)
+	}
+	if verifier := request.signatureVerifier(); verifier != nil {
+		if err := verifier.VerifyResponse(response, responseBody); err != nil {
+			return nil, err
+		}
+	}
 	return responseBody, nil
 }
+
+// encodeData returns the body to send and its Content-Encoding, compressing
+// a copy of Data so the original stays intact for later executions
+func (request *Request) encodeData() ([]byte, string, error) {
+	compression := request.Compression
+	if compression == nil && request.Client != nil {
+		compression = request.Client.Compression
+	}
+	if compression == nil {
+		return request.Data, "", nil
+	}
+	for key := range request.Headers {
+		if http.CanonicalHeaderKey(key) == "Content-Encoding" {
+			return request.Data, "", nil
+		}
+	}
+
+	data, compressed, err := compression.compress(request.Data)
+	if err != nil || !compressed {
+		return data, "", err
+	}
+	return data, compression.Algorithm, nil
+}
+
+// do builds, checks, authenticates and sends one attempt of the request
+func (request *Request) do(ctx context.Context, client *http.Client, target string, data []byte, encoding string, auth Authenticator) (*http.Response, error) {
+	var body io.Reader
+	if len(data) > 0 {
+		body = bytes.NewReader(data)
+	}
+
+	webRequest, err := http.NewRequestWithContext(ctx, request.Method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if request.Client != nil && request.Client.Egress != nil {
+		if err := request.Client.Egress.checkRequest(webRequest); err != nil {
+			return nil, err
+		}
+	}
+
+	for key, value := range request.Headers {
+		webRequest.Header.Add(key, value)
+	}
+	if request.Client != nil {
+		for key, value := range request.Client.Headers {
+			if webRequest.Header.Get(key) == "" {
+				webRequest.Header.Set(key, value)
+			}
+		}
+	}
+	if encoding != "" {
+		webRequest.Header.Set("Content-Encoding", encoding)
+	}
+	if request.signatureVerifier() != nil && webRequest.Header.Get("Accept-Encoding") == "" {
+		// response digests cover the encoded body, which the transport would decompress
+		webRequest.Header.Set("Accept-Encoding", "identity")
+	}
+	if auth != nil {
+		if err := auth.Authenticate(ctx, webRequest); err != nil {
+			return nil, err
+		}
+	}
+	// evaluated last, so rules see the headers added by the Authenticator
+	if request.Client != nil && request.Client.Policy != nil {
+		if err := request.Client.Policy.evaluate(webRequest, int64(len(request.Data)), request.redactor()); err != nil {
+			return nil, err
+		}
+	}
+
+	return client.Do(webRequest)
+}
+
+// authenticator returns the Authenticator of the request or its Client
+func (request *Request) authenticator() Authenticator {
+	if request.Auth != nil {
+		return request.Auth
+	}
+	if request.Client != nil {
+		return request.Client.Auth
+	}
+	return nil
+}
+
+// signatureVerifier returns the MessageVerifier of the request or its Client
+func (request *Request) signatureVerifier() *MessageVerifier {
+	if request.SignatureVerifier != nil {
+		return request.SignatureVerifier
+	}
+	if request.Client != nil {
+		return request.Client.SignatureVerifier
+	}
+	return nil
+}
+
+// timeouts returns the request timeouts completed with those of its Client
+func (request *Request) timeouts() Timeouts {
+	var timeouts Timeouts
+	if request.Timeouts != nil {
+		timeouts = *request.Timeouts
+	}
+	if request.Client != nil && request.Client.Timeouts != nil {
+		timeouts = timeouts.merge(*request.Client.Timeouts)
+	}
+	return timeouts
+}
+
+// minTransferRate returns the transfer rate guard of the request or its Client
+func (request *Request) minTransferRate() *TransferRate {
+	if request.MinTransferRate != nil {
+		return request.MinTransferRate
+	}
+	if request.Client != nil {
+		return request.Client.MinTransferRate
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package webreq_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tonnytg/webreq"
+)
+
+func echoAuthServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("Authorization") + "|" + r.Header.Get("X-Api-Key") + "|" + r.URL.Query().Get("api_key")))
+	}))
+}
+
+func TestAuth_BuiltIns(t *testing.T) {
+	ts := echoAuthServer()
+	defer ts.Close()
+
+	tests := []struct {
+		name string
+		auth webreq.Authenticator
+		want string
+	}{
+		{"basic", webreq.BasicAuth("ana", "s3cret"), "Basic YW5hOnMzY3JldA==||"},
+		{"bearer", webreq.BearerToken("abc"), "Bearer abc||"},
+		{"api key header", webreq.APIKeyHeader("X-Api-Key", "k1"), "|k1|"},
+		{"api key query", webreq.APIKeyQuery("api_key", "k2"), "||k2"},
+	}
+	for _, tt := range tests {
+		body, err := webreq.NewRequest("GET").SetURL(ts.URL + "/?page=1").SetAuth(tt.auth).Execute()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if string(body) != tt.want {
+			t.Fatalf("%s: expected %q, got %q", tt.name, tt.want, string(body))
+		}
+	}
+}
+
+func TestAuth_RequestOverridesClient(t *testing.T) {
+	ts := echoAuthServer()
+	defer ts.Close()
+
+	client := webreq.NewClient().SetAuth(webreq.BearerToken("client"))
+	body, err := webreq.NewRequest("GET").SetURL(ts.URL).SetClient(client).Execute()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(body) != "Bearer client||" {
+		t.Fatalf("unexpected body: %q", string(body))
+	}
+
+	body, err = webreq.NewRequest("GET").SetURL(ts.URL).SetClient(client).SetAuth(webreq.BearerToken("request")).Execute()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(body) != "Bearer request||" {
+		t.Fatalf("unexpected body: %q", string(body))
+	}
+}
+
+func TestAuth_TokenRefreshOn401(t *testing.T) {
+	var current int32 = 1
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		want := "Bearer token-" + strconv.Itoa(int(atomic.LoadInt32(&current)))
+		if r.Header.Get("Authorization") != want {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	var fetches int32
+	source := webreq.TokenSourceFunc(func(ctx context.Context) (*webreq.Token, error) {
+		n := atomic.AddInt32(&fetches, 1)
+		return &webreq.Token{AccessToken: "token-" + strconv.Itoa(int(n)), Expiry: time.Now().Add(time.Hour)}, nil
+	})
+	client := webreq.NewClient().SetAuth(webreq.NewTokenAuthenticator(source))
+
+	for i := 0; i < 3; i++ {
+		req := webreq.NewRequest("POST").SetURL(ts.URL).SetClient(client).SetData([]byte("payload"))
+		if _, err := req.Execute(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if atomic.LoadInt32(&fetches) != 1 {
+		t.Fatalf("expected cached token, got %d fetches", fetches)
+	}
+
+	// the server rotates its token: the next request gets a 401, refetches and retries once
+	atomic.StoreInt32(&current, 2)
+	req := webreq.NewRequest("POST").SetURL(ts.URL).SetClient(client).SetData([]byte("payload"))
+	body, err := req.Execute()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(body) != "ok" || req.StatusCode != http.StatusOK {
+		t.Fatalf("expected retry to succeed, got %d %q", req.StatusCode, string(body))
+	}
+
+	// a server that never accepts the token is retried only once
+	atomic.StoreInt32(&current, 100)
+	req = webreq.NewRequest("GET").SetURL(ts.URL).SetClient(client)
+	if _, err := req.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if req.StatusCode != http.StatusUnauthorized || atomic.LoadInt32(&fetches) != 3 {
+		t.Fatalf("expected a single retry, got status %d after %d fetches", req.StatusCode, fetches)
+	}
+}
+
+func TestAuth_TokenSourceError(t *testing.T) {
+	ts := echoAuthServer()
+	defer ts.Close()
+
+	failure := errors.New("token endpoint down")
+	source := webreq.TokenSourceFunc(func(ctx context.Context) (*webreq.Token, error) {
+		return nil, failure
+	})
+	_, err := webreq.NewRequest("GET").SetURL(ts.URL).SetAuth(webreq.NewTokenAuthenticator(source)).Execute()
+	if !errors.Is(err, failure) {
+		t.Fatalf("expected token source error, got %v", err)
+	}
+}
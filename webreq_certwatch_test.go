@@ -0,0 +1,142 @@
+package webreq_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tonnytg/webreq"
+)
+
+// rotate writes a new key pair and moves the modification time forward so
+// the change is seen even on filesystems with coarse timestamps
+func rotate(t *testing.T, certFile string, keyFile string, certPEM []byte, keyPEM []byte, at time.Time) {
+	if err := os.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = os.Chtimes(certFile, at, at)
+	_ = os.Chtimes(keyFile, at, at)
+}
+
+func TestCertificateWatcher_ReloadsRotatedCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	ts := newTestTLSServer(t, ca, &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	ts.Config.SetKeepAlivesEnabled(false)
+	defer ts.Close()
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	certPEM, keyPEM := ca.issue(t, "client-v1", true)
+	rotate(t, certFile, keyFile, certPEM, keyPEM, time.Now().Add(-time.Minute))
+
+	watcher, err := webreq.NewCertificateWatcher(certFile, keyFile, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer watcher.Close()
+
+	var reloadErrors []error
+	watcher.SetOnReload(func(err error) { reloadErrors = append(reloadErrors, err) })
+
+	config := webreq.NewTLSConfig().SetClientCertificateSource(watcher)
+	_ = config.AddRootCAPEM(ca.pem)
+	client := webreq.NewClient().SetTLSConfig(config)
+
+	body, err := webreq.NewRequest("GET").SetURL(ts.URL).SetClient(client).Execute()
+	if err != nil || string(body) != "client-v1" {
+		t.Fatalf("expected client-v1, got %q, %v", string(body), err)
+	}
+
+	certPEM, keyPEM = ca.issue(t, "client-v2", true)
+	rotate(t, certFile, keyFile, certPEM, keyPEM, time.Now())
+	if err := watcher.Reload(); err != nil {
+		t.Fatalf("unexpected reload error: %v", err)
+	}
+
+	body, err = webreq.NewRequest("GET").SetURL(ts.URL).SetClient(client).Execute()
+	if err != nil || string(body) != "client-v2" {
+		t.Fatalf("expected client-v2 after rotation, got %q, %v", string(body), err)
+	}
+
+	stats := watcher.Stats()
+	if stats.Reloads != 1 || stats.Failures != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if len(reloadErrors) != 1 || reloadErrors[0] != nil {
+		t.Fatalf("expected one successful reload callback, got %v", reloadErrors)
+	}
+}
+
+func TestCertificateWatcher_KeepsCertificateOnFailure(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	certPEM, keyPEM := ca.issue(t, "client-v1", true)
+	rotate(t, certFile, keyFile, certPEM, keyPEM, time.Now().Add(-time.Minute))
+
+	watcher, err := webreq.NewCertificateWatcher(certFile, keyFile, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer watcher.Close()
+
+	rotate(t, certFile, keyFile, certPEM, []byte("half written"), time.Now())
+	if err := watcher.Reload(); err == nil {
+		t.Fatal("expected reload error for invalid key")
+	}
+
+	certificate, _ := watcher.GetClientCertificate(nil)
+	if certificate == nil || len(certificate.Certificate) == 0 {
+		t.Fatal("expected previous certificate to remain in use")
+	}
+	stats := watcher.Stats()
+	if stats.Failures != 1 || stats.LastError == nil {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestCertificateWatcher_PollsFiles(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	certPEM, keyPEM := ca.issue(t, "client-v1", true)
+	rotate(t, certFile, keyFile, certPEM, keyPEM, time.Now().Add(-time.Minute))
+
+	watcher, err := webreq.NewCertificateWatcher(certFile, keyFile, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer watcher.Close()
+
+	certPEM, keyPEM = ca.issue(t, "client-v2", true)
+	rotate(t, certFile, keyFile, certPEM, keyPEM, time.Now())
+
+	deadline := time.Now().Add(2 * time.Second)
+	for watcher.Stats().Reloads == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("watcher did not pick up the rotated files")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCertificateWatcher_MissingFiles(t *testing.T) {
+	if _, err := webreq.NewCertificateWatcher("missing.crt", "missing.key", 0); err == nil {
+		t.Fatal("expected error for missing files")
+	}
+}
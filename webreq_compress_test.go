@@ -0,0 +1,178 @@
+package webreq_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/tonnytg/webreq"
+)
+
+func TestCompression_GzipAboveThreshold(t *testing.T) {
+	payload := bytes.Repeat([]byte("telemetry "), 500)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Content-Encoding"); got != "gzip" {
+			t.Errorf("expected Content-Encoding gzip, got %q", got)
+		}
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("invalid gzip body: %v", err)
+			return
+		}
+		b, err := io.ReadAll(reader)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			return
+		}
+		if !bytes.Equal(b, payload) {
+			t.Errorf("decompressed body does not match payload")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	req := webreq.NewRequest("POST")
+	req.SetURL(ts.URL)
+	req.SetData(payload)
+	req.SetCompression(webreq.NewCompression(webreq.CompressionGzip).SetLevel(gzip.BestSpeed))
+
+	if _, err := req.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(req.Data, payload) {
+		t.Fatalf("request data was modified")
+	}
+}
+
+func TestCompression_BelowThresholdSentAsIs(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Content-Encoding"); got != "" {
+			t.Errorf("expected no Content-Encoding, got %q", got)
+		}
+		b, _ := io.ReadAll(r.Body)
+		if string(b) != "small" {
+			t.Errorf("unexpected body: %q", string(b))
+		}
+	}))
+	defer ts.Close()
+
+	client := webreq.NewClient().SetCompression(webreq.NewCompression(webreq.CompressionGzip))
+
+	req := webreq.NewRequest("POST")
+	req.SetURL(ts.URL)
+	req.SetClient(client)
+	req.SetData([]byte("small"))
+
+	if _, err := req.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestCompression_RewindOnRedirect(t *testing.T) {
+	payload := bytes.Repeat([]byte("a"), 4096)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new", http.StatusTemporaryRedirect)
+	})
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("invalid gzip body after redirect: %v", err)
+			return
+		}
+		b, _ := io.ReadAll(reader)
+		if !bytes.Equal(b, payload) {
+			t.Errorf("body was not replayed on redirect")
+		}
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	req := webreq.NewRequest("POST")
+	req.SetURL(ts.URL + "/old")
+	req.SetData(payload)
+	req.SetCompression(webreq.NewCompression(webreq.CompressionGzip))
+
+	if _, err := req.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestCompression_DeflateIsZlib(t *testing.T) {
+	payload := bytes.Repeat([]byte("deflate "), 500)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Content-Encoding"); got != "deflate" {
+			t.Errorf("expected Content-Encoding deflate, got %q", got)
+		}
+		reader, err := zlib.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("expected a zlib body: %v", err)
+			return
+		}
+		b, _ := io.ReadAll(reader)
+		if !bytes.Equal(b, payload) {
+			t.Errorf("decompressed body does not match payload")
+		}
+	}))
+	defer ts.Close()
+
+	req := webreq.NewRequest("POST")
+	req.SetURL(ts.URL)
+	req.SetData(payload)
+	req.SetCompression(webreq.NewCompression(webreq.CompressionDeflate))
+
+	if _, err := req.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestCompression_ZstdBuiltIn(t *testing.T) {
+	payload := bytes.Repeat([]byte("zstd "), 500)
+
+	for _, level := range []int{0, 1, 19} {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if got := r.Header.Get("Content-Encoding"); got != "zstd" {
+				t.Errorf("expected Content-Encoding zstd, got %q", got)
+			}
+			decoder, err := zstd.NewReader(r.Body)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			defer decoder.Close()
+			b, err := io.ReadAll(decoder)
+			if err != nil || !bytes.Equal(b, payload) {
+				t.Errorf("level %d: decompressed body does not match payload (%v)", level, err)
+			}
+		}))
+
+		req := webreq.NewRequest("POST")
+		req.SetURL(ts.URL)
+		req.SetData(payload)
+		req.SetCompression(webreq.NewCompression(webreq.CompressionZstd).SetLevel(level))
+
+		if _, err := req.Execute(); err != nil {
+			t.Fatalf("level %d: unexpected error: %v", level, err)
+		}
+		ts.Close()
+	}
+}
+
+func TestCompression_UnregisteredAlgorithm(t *testing.T) {
+	req := webreq.NewRequest("POST")
+	req.SetURL("http://127.0.0.1:1")
+	req.SetData(bytes.Repeat([]byte("a"), 4096))
+	req.SetCompression(webreq.NewCompression("br"))
+
+	if _, err := req.Execute(); err == nil {
+		t.Fatal("expected error for unregistered algorithm")
+	}
+}
@@ -0,0 +1,98 @@
+package webreq_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tonnytg/webreq"
+)
+
+// staticResolver answers every lookup from a fixed table
+type staticResolver map[string][]string
+
+func (r staticResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if ips, ok := r[host]; ok {
+		return ips, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func TestResolve_OverridesHostAndKeepsHostHeader(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Host))
+	}))
+	defer ts.Close()
+
+	_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	client := webreq.NewClient().AddResolve("staging.example.com:"+port, "127.0.0.1")
+
+	body, err := webreq.NewRequest("GET").SetURL("http://staging.example.com:" + port + "/").SetClient(client).Execute()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(body) != "staging.example.com:"+port {
+		t.Fatalf("expected original Host header, got %q", string(body))
+	}
+}
+
+func TestResolve_OverrideWithPortAndFallback(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	// the first address refuses connections, the second is the server
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	refused := closed.Addr().String()
+	closed.Close()
+
+	client := webreq.NewClient().AddResolve("api.example.com:80", refused, ts.Listener.Addr().String())
+
+	body, err := webreq.NewRequest("GET").SetURL("http://api.example.com/").SetClient(client).Execute()
+	if err != nil || string(body) != "ok" {
+		t.Fatalf("expected fallback to second address, got %q, %v", string(body), err)
+	}
+}
+
+func TestResolve_KeepsTLSServerName(t *testing.T) {
+	ca := newTestCA(t)
+	ts := newTestTLSServer(t, ca, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.TLS.ServerName))
+	}))
+	defer ts.Close()
+
+	config := webreq.NewTLSConfig()
+	_ = config.AddRootCAPEM(ca.pem)
+	_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	client := webreq.NewClient().SetTLSConfig(config).AddResolve("api.example.com:"+port, "127.0.0.1")
+
+	body, err := webreq.NewRequest("GET").SetURL("https://api.example.com:" + port + "/").SetClient(client).Execute()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(body) != "api.example.com" {
+		t.Fatalf("expected SNI api.example.com, got %q", string(body))
+	}
+}
+
+func TestResolver_Custom(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("resolved"))
+	}))
+	defer ts.Close()
+
+	_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	client := webreq.NewClient().SetResolver(staticResolver{"svc.internal": {"127.0.0.1"}})
+
+	body, err := webreq.NewRequest("GET").SetURL("http://svc.internal:" + port).SetClient(client).Execute()
+	if err != nil || string(body) != "resolved" {
+		t.Fatalf("expected custom resolver to be used, got %q, %v", string(body), err)
+	}
+
+	if _, err := webreq.NewRequest("GET").SetURL("http://unknown.internal:" + port).SetClient(client).Execute(); err == nil {
+		t.Fatal("expected lookup error for unknown host")
+	}
+}
@@ -0,0 +1,182 @@
+package webreq
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// RFC 7616 section 3.9.1
+const (
+	rfcDigestChallenge = `Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=%s, ` +
+		`nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`
+	rfcDigestCnonce = "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ"
+)
+
+func TestDigest_RFC7616Vectors(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		response  string
+	}{
+		{"MD5", "8ca523f5e9506fed4657c9700eebdbec"},
+		{"SHA-256", "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"},
+	}
+	for _, tt := range tests {
+		challenge := parseDigestChallenges([]string{strings.Replace(rfcDigestChallenge, "%s", tt.algorithm, 1)})
+		if challenge == nil {
+			t.Fatalf("%s: challenge not parsed", tt.algorithm)
+		}
+		header, err := challenge.authorization("Mufasa", "Circle of Life", "GET", "/dir/index.html", "auth", 1, rfcDigestCnonce, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(header, `response="`+tt.response+`"`) {
+			t.Fatalf("%s: unexpected authorization %s", tt.algorithm, header)
+		}
+		for _, field := range []string{`nc=00000001`, `qop=auth`, `opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`} {
+			if !strings.Contains(header, field) {
+				t.Fatalf("%s: expected %s in %s", tt.algorithm, field, header)
+			}
+		}
+	}
+}
+
+func TestDigest_PrefersStrongestChallenge(t *testing.T) {
+	challenge := parseDigestChallenges([]string{
+		`Basic realm="x", Digest realm="r", nonce="n1", algorithm=MD5, qop="auth"`,
+		`Digest realm="r", nonce="n2", algorithm=SHA-256-sess, qop="auth"`,
+		`Digest realm="r", nonce="n3", algorithm=SHA-512-256`,
+	})
+	if challenge == nil || challenge.nonce != "n2" || challenge.algorithm != "SHA-256-sess" {
+		t.Fatalf("unexpected challenge: %+v", challenge)
+	}
+}
+
+// digestServer verifies digest responses the way an appliance would
+type digestServer struct {
+	*httptest.Server
+	algorithm string
+	qop       string
+	mu        sync.Mutex
+	nonce     int
+	counts    []string
+	bodies    []string
+}
+
+func newDigestServer(t *testing.T, algorithm string, qop string) *digestServer {
+	server := &digestServer{algorithm: algorithm, qop: qop, nonce: 1}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		server.bodies = append(server.bodies, string(body))
+
+		params := digestChallengeParams(r.Header.Get("Authorization"))
+		nonce := "nonce-" + strconv.Itoa(server.nonce)
+		if len(params) != 1 || params[0]["nonce"] != nonce || !server.valid(params[0], r, body) {
+			stale := ""
+			if len(params) == 1 && params[0]["nonce"] != nonce {
+				stale = ", stale=true"
+			}
+			w.Header().Set("WWW-Authenticate", `Digest realm="appliance", nonce="`+nonce+`", opaque="op", algorithm=`+server.algorithm+`, qop="`+server.qop+`"`+stale)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		server.counts = append(server.counts, params[0]["nc"])
+		_, _ = w.Write([]byte("welcome " + params[0]["username"]))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (server *digestServer) valid(params map[string]string, r *http.Request, body []byte) bool {
+	newHash := md5.New
+	if strings.HasPrefix(server.algorithm, "SHA-256") {
+		newHash = func() hash.Hash { return sha256.New() }
+	}
+	h := func(s string) string {
+		sum := newHash()
+		sum.Write([]byte(s))
+		return hex.EncodeToString(sum.Sum(nil))
+	}
+	ha1 := h("admin:appliance:secret")
+	if strings.HasSuffix(server.algorithm, "-sess") {
+		ha1 = h(ha1 + ":" + params["nonce"] + ":" + params["cnonce"])
+	}
+	ha2 := h(r.Method + ":" + r.URL.RequestURI())
+	if params["qop"] == "auth-int" {
+		ha2 = h(r.Method + ":" + r.URL.RequestURI() + ":" + h(string(body)))
+	}
+	expected := h(ha1 + ":" + params["nonce"] + ":" + params["nc"] + ":" + params["cnonce"] + ":" + params["qop"] + ":" + ha2)
+	return params["response"] == expected && params["uri"] == r.URL.RequestURI() && params["opaque"] == "op"
+}
+
+func TestDigest_ChallengeReplaysData(t *testing.T) {
+	for _, algorithm := range []string{"MD5", "MD5-sess", "SHA-256", "SHA-256-sess"} {
+		for _, qop := range []string{"auth", "auth-int"} {
+			server := newDigestServer(t, algorithm, qop)
+			req := NewRequest("POST").SetURL(server.URL + "/config?section=net").SetData([]byte(`{"dhcp":true}`))
+			req.SetAuth(NewDigestAuth("admin", "secret"))
+
+			body, err := req.Execute()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(body) != "welcome admin" {
+				t.Fatalf("%s %s: unexpected response %d %q", algorithm, qop, req.StatusCode, string(body))
+			}
+			if len(server.bodies) != 2 || server.bodies[1] != `{"dhcp":true}` {
+				t.Fatalf("%s %s: expected body replayed on the challenge, got %q", algorithm, qop, server.bodies)
+			}
+		}
+	}
+}
+
+func TestDigest_NonceReuseAndStale(t *testing.T) {
+	server := newDigestServer(t, "SHA-256", "auth")
+	client := NewClient().SetAuth(NewDigestAuth("admin", "secret"))
+
+	for i := 0; i < 3; i++ {
+		if _, err := NewRequest("GET").SetURL(server.URL).SetClient(client).Execute(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// only the first request needed a challenge round trip
+	if len(server.bodies) != 4 {
+		t.Fatalf("expected 4 round trips, got %d", len(server.bodies))
+	}
+	if strings.Join(server.counts, ",") != "00000001,00000002,00000003" {
+		t.Fatalf("unexpected nonce counts: %v", server.counts)
+	}
+
+	// the server rotates its nonce: the stale nonce is answered with a fresh challenge
+	server.mu.Lock()
+	server.nonce = 2
+	server.mu.Unlock()
+	req := NewRequest("GET").SetURL(server.URL).SetClient(client)
+	if _, err := req.Execute(); err != nil || req.StatusCode != http.StatusOK {
+		t.Fatalf("expected retry with the new nonce, got %d: %v", req.StatusCode, err)
+	}
+	if server.counts[len(server.counts)-1] != "00000001" {
+		t.Fatalf("expected nonce count to restart, got %v", server.counts)
+	}
+}
+
+func TestDigest_WrongPassword(t *testing.T) {
+	server := newDigestServer(t, "MD5", "auth")
+	req := NewRequest("GET").SetURL(server.URL).SetAuth(NewDigestAuth("admin", "wrong"))
+	if _, err := req.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if req.StatusCode != http.StatusUnauthorized || len(server.bodies) != 2 {
+		t.Fatalf("expected a single retry ending in 401, got %d after %d requests", req.StatusCode, len(server.bodies))
+	}
+}
@@ -0,0 +1,234 @@
+package webreq
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingResolver returns fixed answers and counts upstream queries
+type countingResolver struct {
+	mu    sync.Mutex
+	addrs []string
+	err   error
+	delay time.Duration
+	calls int32
+}
+
+func (r *countingResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	atomic.AddInt32(&r.calls, 1)
+	time.Sleep(r.delay)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.addrs, r.err
+}
+
+func (r *countingResolver) set(addrs []string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.addrs, r.err = addrs, err
+}
+
+// fakeClock is a settable time source
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestCachingResolver(upstream Resolver) (*CachingResolver, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	resolver := NewCachingResolver(upstream)
+	resolver.now = clock.Now
+	return resolver, clock
+}
+
+func TestCachingResolver_CachesAndRoundRobins(t *testing.T) {
+	upstream := &countingResolver{addrs: []string{"10.0.0.1", "10.0.0.2"}}
+	resolver, _ := newTestCachingResolver(upstream)
+
+	first, _ := resolver.LookupHost(context.Background(), "api.example.com")
+	second, _ := resolver.LookupHost(context.Background(), "api.example.com")
+
+	if !reflect.DeepEqual(first, []string{"10.0.0.1", "10.0.0.2"}) || !reflect.DeepEqual(second, []string{"10.0.0.2", "10.0.0.1"}) {
+		t.Fatalf("expected round-robin order, got %v then %v", first, second)
+	}
+	if calls := atomic.LoadInt32(&upstream.calls); calls != 1 {
+		t.Fatalf("expected one upstream query, got %d", calls)
+	}
+}
+
+func TestCachingResolver_ExpiresAfterTTL(t *testing.T) {
+	upstream := &countingResolver{addrs: []string{"10.0.0.1"}}
+	resolver, clock := newTestCachingResolver(upstream)
+
+	_, _ = resolver.LookupHost(context.Background(), "api.example.com")
+	clock.Advance(DefaultDNSCacheTTL + time.Second)
+	upstream.set([]string{"10.0.0.9"}, nil)
+
+	addrs, err := resolver.LookupHost(context.Background(), "api.example.com")
+	if err != nil || !reflect.DeepEqual(addrs, []string{"10.0.0.9"}) {
+		t.Fatalf("expected fresh answer after TTL, got %v, %v", addrs, err)
+	}
+}
+
+func TestCachingResolver_NegativeCaching(t *testing.T) {
+	notFound := &net.DNSError{Err: "no such host", Name: "gone.example.com", IsNotFound: true}
+	upstream := &countingResolver{err: notFound}
+	resolver, clock := newTestCachingResolver(upstream)
+
+	for i := 0; i < 3; i++ {
+		if _, err := resolver.LookupHost(context.Background(), "gone.example.com"); !errors.Is(err, notFound) {
+			t.Fatalf("expected not found error, got %v", err)
+		}
+	}
+	if calls := atomic.LoadInt32(&upstream.calls); calls != 1 {
+		t.Fatalf("expected negative answer to be cached, got %d queries", calls)
+	}
+
+	clock.Advance(DefaultDNSCacheNegativeTTL + time.Second)
+	_, _ = resolver.LookupHost(context.Background(), "gone.example.com")
+	if calls := atomic.LoadInt32(&upstream.calls); calls != 2 {
+		t.Fatalf("expected query after negative TTL, got %d", calls)
+	}
+}
+
+func TestCachingResolver_ServesStaleOnFailure(t *testing.T) {
+	upstream := &countingResolver{addrs: []string{"10.0.0.1"}}
+	resolver, clock := newTestCachingResolver(upstream)
+
+	_, _ = resolver.LookupHost(context.Background(), "api.example.com")
+	clock.Advance(DefaultDNSCacheTTL + time.Second)
+	upstream.set(nil, &net.DNSError{Err: "server misbehaving", Name: "api.example.com", IsTemporary: true})
+
+	addrs, err := resolver.LookupHost(context.Background(), "api.example.com")
+	if err != nil || !reflect.DeepEqual(addrs, []string{"10.0.0.1"}) {
+		t.Fatalf("expected stale answer, got %v, %v", addrs, err)
+	}
+
+	clock.Advance(DefaultDNSCacheStaleTTL)
+	if _, err := resolver.LookupHost(context.Background(), "api.example.com"); err == nil {
+		t.Fatal("expected error once the stale window has passed")
+	}
+}
+
+func TestCachingResolver_RefreshesInBackground(t *testing.T) {
+	upstream := &countingResolver{addrs: []string{"10.0.0.1"}}
+	resolver, clock := newTestCachingResolver(upstream)
+
+	_, _ = resolver.LookupHost(context.Background(), "api.example.com")
+	clock.Advance(DefaultDNSCacheTTL - time.Second)
+	upstream.set([]string{"10.0.0.2"}, nil)
+
+	addrs, _ := resolver.LookupHost(context.Background(), "api.example.com")
+	if !reflect.DeepEqual(addrs, []string{"10.0.0.1"}) {
+		t.Fatalf("expected cached answer while refreshing, got %v", addrs)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		addrs, _ = resolver.LookupHost(context.Background(), "api.example.com")
+		if reflect.DeepEqual(addrs, []string{"10.0.0.2"}) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("background refresh did not replace the entry")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCachingResolver_CoalescesConcurrentLookups(t *testing.T) {
+	upstream := &countingResolver{addrs: []string{"10.0.0.1"}, delay: 50 * time.Millisecond}
+	resolver, _ := newTestCachingResolver(upstream)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = resolver.LookupHost(context.Background(), "api.example.com")
+		}()
+	}
+	wg.Wait()
+
+	if calls := atomic.LoadInt32(&upstream.calls); calls != 1 {
+		t.Fatalf("expected concurrent lookups to share one query, got %d", calls)
+	}
+}
+
+// contextResolver answers after a delay unless ctx is done first
+type contextResolver struct {
+	delay time.Duration
+}
+
+func (r contextResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	select {
+	case <-time.After(r.delay):
+		return []string{"10.0.0.1"}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestCachingResolver_SharedLookupOutlivesFirstCaller(t *testing.T) {
+	resolver, _ := newTestCachingResolver(contextResolver{delay: 100 * time.Millisecond})
+
+	leader, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := resolver.LookupHost(leader, "api.example.com")
+		leaderErr <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	addrs, err := resolver.LookupHost(context.Background(), "api.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(addrs, []string{"10.0.0.1"}) {
+		t.Fatalf("unexpected addresses %v", addrs)
+	}
+	if err := <-leaderErr; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the first caller to give up on its own deadline, got %v", err)
+	}
+}
+
+func TestCachingResolver_DropsEntriesPastStaleTTL(t *testing.T) {
+	upstream := &countingResolver{addrs: []string{"10.0.0.1"}}
+	resolver, clock := newTestCachingResolver(upstream)
+
+	if _, err := resolver.LookupHost(context.Background(), "once.example.com"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	clock.Advance(resolver.TTL + resolver.StaleTTL + dnsSweepInterval)
+	if _, err := resolver.LookupHost(context.Background(), "api.example.com"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	resolver.mu.Lock()
+	defer resolver.mu.Unlock()
+	if _, ok := resolver.entries["once.example.com"]; ok {
+		t.Error("expected the entry past its StaleTTL to be dropped")
+	}
+	if _, ok := resolver.entries["api.example.com"]; !ok {
+		t.Error("expected the fresh entry to be kept")
+	}
+}
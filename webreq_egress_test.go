@@ -0,0 +1,142 @@
+package webreq_test
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/tonnytg/webreq"
+)
+
+func expectEgressDenied(t *testing.T, err error) {
+	t.Helper()
+	if !errors.Is(err, webreq.ErrEgressDenied) {
+		t.Fatalf("expected ErrEgressDenied, got %v", err)
+	}
+}
+
+func TestEgress_DefaultPolicyBlocksLoopback(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+	}))
+	defer ts.Close()
+
+	client := webreq.NewClient().SetEgressPolicy(webreq.NewEgressPolicy())
+	_, err := webreq.NewRequest("GET").SetURL(ts.URL).SetClient(client).Execute()
+	expectEgressDenied(t, err)
+	if atomic.LoadInt32(&hits) != 0 {
+		t.Fatal("request reached a denied address")
+	}
+}
+
+func TestEgress_CheckedAfterResolution(t *testing.T) {
+	client := webreq.NewClient().
+		SetResolver(staticResolver{
+			"rebind.example.com":   {"127.0.0.1"},
+			"metadata.example.com": {"169.254.169.254"},
+			"mapped.example.com":   {"::ffff:10.0.0.1"},
+		}).
+		SetEgressPolicy(webreq.NewEgressPolicy())
+
+	for _, host := range []string{"rebind.example.com", "metadata.example.com", "mapped.example.com"} {
+		_, err := webreq.NewRequest("GET").SetURL("http://" + host + "/").SetClient(client).Execute()
+		expectEgressDenied(t, err)
+	}
+}
+
+func TestEgress_AllowedNetworks(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(okHandler))
+	defer ts.Close()
+
+	policy := &webreq.EgressPolicy{}
+	if err := policy.Allow("127.0.0.0/8"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	client := webreq.NewClient().
+		SetResolver(staticResolver{"public.example.com": {"192.0.2.10"}}).
+		SetEgressPolicy(policy)
+
+	if _, err := webreq.NewRequest("GET").SetURL(ts.URL).SetClient(client).Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err := webreq.NewRequest("GET").SetURL("http://public.example.com/").SetClient(client).Execute()
+	expectEgressDenied(t, err)
+}
+
+func TestEgress_Ports(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(okHandler))
+	defer ts.Close()
+	_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	allowed, _ := strconv.Atoi(port)
+
+	policy := (&webreq.EgressPolicy{}).AllowPorts(allowed)
+	client := webreq.NewClient().SetEgressPolicy(policy)
+	if _, err := webreq.NewRequest("GET").SetURL(ts.URL).SetClient(client).Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	policy.AllowedPorts = []int{443}
+	_, err := webreq.NewRequest("GET").SetURL(ts.URL).SetClient(client).Execute()
+	expectEgressDenied(t, err)
+}
+
+func TestEgress_Schemes(t *testing.T) {
+	client := webreq.NewClient().SetEgressPolicy(webreq.NewEgressPolicy()).SetUnixSocketURLs(true)
+	_, err := webreq.NewRequest("GET").
+		SetURL(webreq.UnixSocketURL("/var/run/docker.sock", "/info")).
+		SetClient(client).
+		Execute()
+	expectEgressDenied(t, err)
+}
+
+func TestEgress_RedirectHopsAreChecked(t *testing.T) {
+	var internalHits int32
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&internalHits, 1)
+	}))
+	defer internal.Close()
+	_, internalPort, _ := net.SplitHostPort(internal.Listener.Addr().String())
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://"+r.URL.Query().Get("host")+":"+internalPort+"/", http.StatusFound)
+	}))
+	defer ts.Close()
+
+	policy := &webreq.EgressPolicy{}
+	if err := policy.Deny("10.0.0.0/8"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	client := webreq.NewClient().
+		SetResolver(staticResolver{
+			"mixed.example.com":    {"10.0.0.5", "127.0.0.1"},
+			"internal.example.com": {"10.0.0.5"},
+		}).
+		SetEgressPolicy(policy)
+
+	// the denied address is skipped and the hop lands on the allowed one
+	if _, err := webreq.NewRequest("GET").SetURL(ts.URL + "?host=mixed.example.com").SetClient(client).Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if atomic.LoadInt32(&internalHits) != 1 {
+		t.Fatalf("expected redirect to reach the allowed address, got %d hits", internalHits)
+	}
+
+	_, err := webreq.NewRequest("GET").SetURL(ts.URL + "?host=internal.example.com").SetClient(client).Execute()
+	expectEgressDenied(t, err)
+}
+
+func TestEgress_RedirectSchemeIsChecked(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "ftp://files.example.com/", http.StatusFound)
+	}))
+	defer ts.Close()
+
+	client := webreq.NewClient().SetEgressPolicy(&webreq.EgressPolicy{})
+	_, err := webreq.NewRequest("GET").SetURL(ts.URL).SetClient(client).Execute()
+	expectEgressDenied(t, err)
+}
@@ -0,0 +1,63 @@
+package webreq
+
+import (
+	"context"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestDialer_RacesAddressFamilies(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer listener.Close()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	d := NewClient().AddResolve("api.example.com:443", "[::1]:"+port, "127.0.0.1:"+port).newDialer()
+	// the IPv6 primary hangs, as a broken IPv6 route would
+	d.net.Control = func(network string, address string, c syscall.RawConn) error {
+		if strings.HasPrefix(address, "[::1]") {
+			time.Sleep(2 * time.Second)
+		}
+		return nil
+	}
+
+	start := time.Now()
+	conn, err := d.DialContext(context.Background(), "tcp", "api.example.com:443")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the IPv4 fallback after %v, took %v", fallbackDelay, elapsed)
+	}
+	if got := conn.RemoteAddr().String(); got != listener.Addr().String() {
+		t.Errorf("expected a connection to %s, got %s", listener.Addr(), got)
+	}
+}
+
+func TestDialer_PartialDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if _, ok := partialDeadline(ctx, 1); ok {
+		t.Error("expected the last candidate to get the whole deadline")
+	}
+	if share, ok := partialDeadline(ctx, 3); !ok || time.Until(share) > 10*time.Second || time.Until(share) < 9*time.Second {
+		t.Errorf("expected a third of the time left, got %v", time.Until(share))
+	}
+	if share, _ := partialDeadline(ctx, 100); time.Until(share) < time.Second {
+		t.Errorf("expected the two second floor, got %v", time.Until(share))
+	}
+
+	short, cancelShort := context.WithTimeout(context.Background(), time.Second)
+	defer cancelShort()
+	deadline, _ := short.Deadline()
+	if share, _ := partialDeadline(short, 3); !share.Equal(deadline) {
+		t.Errorf("expected the overall deadline under the floor, got %v", share)
+	}
+}
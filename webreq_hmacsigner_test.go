@@ -0,0 +1,151 @@
+package webreq_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tonnytg/webreq"
+)
+
+// webhookRequest builds a received request with the given body and headers
+func webhookRequest(body string, headers map[string]string) *http.Request {
+	req := httptest.NewRequest("POST", "/webhook", strings.NewReader(body))
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	return req
+}
+
+func TestHMACSigner_ProviderVectors(t *testing.T) {
+	// example from the GitHub webhook documentation
+	github := webhookRequest("Hello, World!", map[string]string{
+		"X-Hub-Signature-256": "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17",
+	})
+	if err := webreq.GitHubHMAC([]byte("It's a Secret to Everybody")).Verify(github, []byte("Hello, World!")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// example from the Slack request signing documentation
+	slackBody := "token=xyzz0WbapA4vBCDEFasx0q6G&team_id=T1DC2JH3J&team_domain=testteamnow&channel_id=G8PSS9T3V&channel_name=foobar&user_id=U2CERLKJA&user_name=roadrunner&command=%2Fwebhook-collect&text=&response_url=https%3A%2F%2Fhooks.slack.com%2Fcommands%2FT1DC2JH3J%2F397700885554%2F96rGlfmibIGlgcZRskXaIFfN&trigger_id=398738663015.47445629121.803a0bc887a14d10d2c447fce8b6703c"
+	slack := webhookRequest(slackBody, map[string]string{
+		"X-Slack-Request-Timestamp": "1531420618",
+		"X-Slack-Signature":         "v0=a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b503",
+	})
+	signer := webreq.SlackHMAC([]byte("8f742231b10e8888abcd99yyyzzz85a5")).SetTolerance(0)
+	if err := signer.Verify(slack, []byte(slackBody)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := signer.Verify(slack, []byte(slackBody+"&admin=true")); !errors.Is(err, webreq.ErrSignatureInvalid) {
+		t.Errorf("expected ErrSignatureInvalid for a modified body, got %v", err)
+	}
+}
+
+func TestHMACSigner_RoundTrip(t *testing.T) {
+	secret := []byte("whsec_test")
+	tests := []struct {
+		name   string
+		signer func() *webreq.HMACSigner
+	}{
+		{"default", func() *webreq.HMACSigner { return webreq.NewHMACSigner(secret) }},
+		{"github", func() *webreq.HMACSigner { return webreq.GitHubHMAC(secret) }},
+		{"stripe", func() *webreq.HMACSigner { return webreq.StripeHMAC(secret) }},
+		{"slack", func() *webreq.HMACSigner { return webreq.SlackHMAC(secret) }},
+		{"custom", func() *webreq.HMACSigner {
+			return webreq.NewHMACSigner(secret).
+				SetHash(sha512.New).
+				SetPayload("{method}\n{path}\n{host}\n{header:Content-Type}\n{timestamp}\n{body}").
+				SetHeader("Authorization", "HMAC-SHA512 ts={timestamp}, sig={signature}").
+				SetTimestampHeader("").
+				SetEncoding(webreq.HMACEncodingBase64)
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			verifier := test.signer()
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if err := verifier.Verify(r, body); err != nil {
+					http.Error(w, err.Error(), http.StatusUnauthorized)
+					return
+				}
+				_, _ = w.Write([]byte("ok"))
+			}))
+			defer server.Close()
+
+			request := webreq.NewRequest("POST").SetURL(server.URL + "/hooks?id=1").SetAuth(test.signer())
+			request.SetHeaders(webreq.HeadersMap{"Content-Type": "application/json"}).SetData([]byte(`{"event": "paid"}`))
+			body, err := request.Execute()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if request.StatusCode != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", request.StatusCode, body)
+			}
+
+			// the same signature does not verify for another secret
+			other := test.signer()
+			other.Secret = []byte("other")
+			signed, err := http.NewRequest("POST", "http://example.com/webhook", strings.NewReader(`{"event": "paid"}`))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := test.signer().Authenticate(context.Background(), signed); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := other.Verify(signed, []byte(`{"event": "paid"}`)); !errors.Is(err, webreq.ErrSignatureInvalid) {
+				t.Errorf("expected ErrSignatureInvalid, got %v", err)
+			}
+		})
+	}
+}
+
+func TestHMACSigner_Tolerance(t *testing.T) {
+	secret := []byte("whsec_test")
+	body := `{"event": "paid"}`
+	stripeHeader := func(at time.Time) string {
+		timestamp := strconv.FormatInt(at.Unix(), 10)
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(timestamp + "." + body))
+		return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil)) + ",v0=unused"
+	}
+
+	signer := webreq.StripeHMAC(secret)
+	fresh := webhookRequest(body, map[string]string{"Stripe-Signature": stripeHeader(time.Now().Add(-time.Minute))})
+	if err := signer.Verify(fresh, []byte(body)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	for _, at := range []time.Time{time.Now().Add(-time.Hour), time.Now().Add(time.Hour)} {
+		replayed := webhookRequest(body, map[string]string{"Stripe-Signature": stripeHeader(at)})
+		if err := signer.Verify(replayed, []byte(body)); !errors.Is(err, webreq.ErrSignatureInvalid) {
+			t.Errorf("expected ErrSignatureInvalid for a timestamp at %v, got %v", at, err)
+		}
+	}
+
+	missing := webhookRequest(body, nil)
+	if err := signer.Verify(missing, []byte(body)); !errors.Is(err, webreq.ErrSignatureInvalid) {
+		t.Errorf("expected ErrSignatureInvalid for a missing header, got %v", err)
+	}
+}
+
+func TestHMACSigner_UnsentTimestamp(t *testing.T) {
+	signer := webreq.NewHMACSigner([]byte("secret")).SetTimestampHeader("")
+	req, err := http.NewRequest("POST", "http://example.com/webhook", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := signer.Authenticate(context.Background(), req); err == nil {
+		t.Error("expected an error when the signed timestamp is not sent")
+	}
+}
@@ -0,0 +1,182 @@
+package webreq
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// parseOAuth1Header returns the decoded parameters of an OAuth Authorization header
+func parseOAuth1Header(t *testing.T, header string) map[string]string {
+	t.Helper()
+	if !strings.HasPrefix(header, "OAuth ") {
+		t.Fatalf("unexpected Authorization header %q", header)
+	}
+	params := map[string]string{}
+	for _, field := range strings.Split(strings.TrimPrefix(header, "OAuth "), ", ") {
+		name, value, _ := strings.Cut(field, "=")
+		decoded, err := url.PathUnescape(strings.Trim(value, `"`))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		params[name] = decoded
+	}
+	return params
+}
+
+func TestOAuth1_BaseStringRFC5849(t *testing.T) {
+	// the example of RFC 5849 section 3.4.1.1
+	req, err := http.NewRequest("POST", "http://example.com/request?b5=%3D%253D&a3=a&c%40=&a2=r%20b", strings.NewReader("c2&a3=2+q"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	base, err := oauth1BaseString(req, map[string]string{
+		"oauth_consumer_key":     "9djdj82h48djs9d2",
+		"oauth_token":            "kkk9d7dh3k39sjv7",
+		"oauth_signature_method": "HMAC-SHA1",
+		"oauth_timestamp":        "137131201",
+		"oauth_nonce":            "7d8f3e4a",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "POST&http%3A%2F%2Fexample.com%2Frequest&a2%3Dr%2520b%26a3%3D2%2520q%26a3%3Da%26b5%3D%253D%25253D%26c%2540%3D%26c2%3D%26oauth_consumer_key%3D9djdj82h48djs9d2%26oauth_nonce%3D7d8f3e4a%26oauth_signature_method%3DHMAC-SHA1%26oauth_timestamp%3D137131201%26oauth_token%3Dkkk9d7dh3k39sjv7"
+	if base != want {
+		t.Errorf("base string =\n%s\nwant\n%s", base, want)
+	}
+}
+
+func TestOAuth1_HMACSHA1(t *testing.T) {
+	// the example of the Twitter API documentation
+	signer := NewOAuth1Signer("xvz1evFS4wEEPTGEFPHBog", "kAcSOqF21Fu85e7zjz7ZN2U4ZRhfV3WpwPAoE3Z7kBw",
+		"370773112-GmHxMAgYyLbNEtIKZeRNFsMKPR9EyMZeS9weJAEb", "LswwdoUaIvS8ltyTt5jkRh4J50vUPVVHtR2YPi5kE")
+	signer.now = func() time.Time { return time.Unix(1318622958, 0) }
+	signer.nonce = func() (string, error) { return "kYjzVBB8Y0ZFabxSWbWovY3uYSQ2pTgmZeNu2VS4cg", nil }
+
+	body := "status=Hello%20Ladies%20%2b%20Gentlemen%2c%20a%20signed%20OAuth%20request%21"
+	req, err := http.NewRequest("POST", "https://api.twitter.com/1.1/statuses/update.json?include_entities=true", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err := signer.Authenticate(context.Background(), req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	params := parseOAuth1Header(t, req.Header.Get("Authorization"))
+	if got, want := params["oauth_signature"], "hCtSmYh+iHYCEqBWrE7C7hYmtUk="; got != want {
+		t.Errorf("oauth_signature = %s, want %s", got, want)
+	}
+	if params["oauth_version"] != "1.0" || params["oauth_token"] != signer.Token {
+		t.Errorf("unexpected header parameters %v", params)
+	}
+}
+
+func TestOAuth1_PlaintextAndRealm(t *testing.T) {
+	signer := NewOAuth1Signer("key", "consumer&secret", "", "").
+		SetSignatureMethod(OAuth1Plaintext).
+		SetRealm("Photos").
+		SetParam("oauth_callback", "http://127.0.0.1:8080/ready")
+	req, err := http.NewRequest("POST", "https://photos.example.net/initiate", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := signer.Authenticate(context.Background(), req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	header := req.Header.Get("Authorization")
+	if !strings.HasPrefix(header, `OAuth realm="Photos", `) {
+		t.Errorf("expected the realm first, got %s", header)
+	}
+	params := parseOAuth1Header(t, header)
+	if got, want := params["oauth_signature"], "consumer%26secret&"; got != want {
+		t.Errorf("oauth_signature = %s, want %s", got, want)
+	}
+	if _, ok := params["oauth_token"]; ok {
+		t.Error("expected no oauth_token for a two-legged request")
+	}
+	if params["oauth_callback"] != "http://127.0.0.1:8080/ready" {
+		t.Errorf("unexpected oauth_callback %q", params["oauth_callback"])
+	}
+}
+
+func TestOAuth1_RSASHA1ThroughRequest(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var verifyErr error
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := parseOAuth1Header(t, r.Header.Get("Authorization"))
+		signature, err := base64.StdEncoding.DecodeString(params["oauth_signature"])
+		if err != nil {
+			verifyErr = err
+			return
+		}
+		delete(params, "oauth_signature")
+
+		// rebuild the base string as the server sees the request
+		body := new(bytes.Buffer)
+		_, _ = body.ReadFrom(r.Body)
+		received, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), bytes.NewReader(body.Bytes()))
+		received.Header = r.Header
+		base, err := oauth1BaseString(received, params)
+		if err != nil {
+			verifyErr = err
+			return
+		}
+		digest := sha1.Sum([]byte(base))
+		verifyErr = rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA1, digest[:], signature)
+	}))
+	defer server.Close()
+
+	signer := NewOAuth1Signer("consumer", "", "token", "").SetRSAKey(key)
+	request := NewRequest("POST").SetURL(server.URL + "/photos?size=original").SetAuth(signer)
+	request.SetHeaders(HeadersMap{"Content-Type": "application/x-www-form-urlencoded"}).SetData([]byte("file=vacation.jpg&title=a+b"))
+	if _, err := request.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if verifyErr != nil {
+		t.Errorf("signature did not verify: %v", verifyErr)
+	}
+}
+
+func TestOAuth1_SecretSources(t *testing.T) {
+	var calls int
+	signer := NewOAuth1Signer("key", "", "token", "").
+		SetSignatureMethod(OAuth1Plaintext).
+		SetSecretSources(SecretFunc(func(ctx context.Context) (string, error) {
+			calls++
+			return "consumer&secret", nil
+		}), StaticSecret("token secret"))
+
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest("GET", "https://photos.example.net/photos", nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := signer.Authenticate(context.Background(), req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		params := parseOAuth1Header(t, req.Header.Get("Authorization"))
+		if got, want := params["oauth_signature"], "consumer%26secret&token%20secret"; got != want {
+			t.Errorf("oauth_signature = %s, want %s", got, want)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("expected the consumer secret to be resolved for every request, got %d calls", calls)
+	}
+}
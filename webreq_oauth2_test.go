@@ -0,0 +1,390 @@
+package webreq_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tonnytg/webreq"
+)
+
+// tokenEndpoint is a minimal OAuth2 token endpoint recording the forms it receives
+type tokenEndpoint struct {
+	*httptest.Server
+	mu      sync.Mutex
+	forms   []map[string]string
+	issued  int32
+	expires int
+	delay   time.Duration
+	reply   func(form map[string]string, w http.ResponseWriter) bool
+}
+
+func newTokenEndpoint(t *testing.T) *tokenEndpoint {
+	endpoint := &tokenEndpoint{expires: 3600}
+	endpoint.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		form := map[string]string{}
+		for key := range r.PostForm {
+			form[key] = r.PostForm.Get(key)
+		}
+		if user, pass, ok := r.BasicAuth(); ok {
+			form["basic"] = user + ":" + pass
+		}
+		endpoint.mu.Lock()
+		endpoint.forms = append(endpoint.forms, form)
+		endpoint.mu.Unlock()
+
+		time.Sleep(endpoint.delay)
+		if endpoint.reply != nil && endpoint.reply(form, w) {
+			return
+		}
+		n := atomic.AddInt32(&endpoint.issued, 1)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "access-" + strconv.Itoa(int(n)),
+			"token_type":    "bearer",
+			"expires_in":    endpoint.expires,
+			"refresh_token": "refresh-" + strconv.Itoa(int(n)),
+		})
+	}))
+	t.Cleanup(endpoint.Close)
+	return endpoint
+}
+
+func (endpoint *tokenEndpoint) form(i int) map[string]string {
+	endpoint.mu.Lock()
+	defer endpoint.mu.Unlock()
+	return endpoint.forms[i]
+}
+
+func TestOAuth2_ClientCredentials(t *testing.T) {
+	endpoint := newTokenEndpoint(t)
+	config := &webreq.OAuth2Config{
+		TokenURL:       endpoint.URL,
+		ClientID:       "svc",
+		ClientSecret:   "s3cret",
+		Scopes:         []string{"read", "write"},
+		EndpointParams: map[string][]string{"audience": {"https://api.example.com"}},
+	}
+	source := config.ClientCredentials()
+
+	token, err := source.Token(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token.AccessToken != "access-1" || time.Until(token.Expiry) < 59*time.Minute {
+		t.Fatalf("unexpected token: %+v", token)
+	}
+	form := endpoint.form(0)
+	if form["grant_type"] != "client_credentials" || form["scope"] != "read write" ||
+		form["audience"] != "https://api.example.com" || form["basic"] != "svc:s3cret" {
+		t.Fatalf("unexpected token request: %v", form)
+	}
+
+	// cached until close to expiry
+	if token, _ := source.Token(context.Background()); token.AccessToken != "access-1" {
+		t.Fatalf("expected cached token, got %s", token.AccessToken)
+	}
+
+	config.AuthInParams = true
+	if _, err := config.ClientCredentials().Token(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	form = endpoint.form(1)
+	if form["client_id"] != "svc" || form["client_secret"] != "s3cret" || form["basic"] != "" {
+		t.Fatalf("expected credentials in form, got %v", form)
+	}
+}
+
+func TestOAuth2_EarlyRefresh(t *testing.T) {
+	endpoint := newTokenEndpoint(t)
+	endpoint.expires = 5
+	source := (&webreq.OAuth2Config{TokenURL: endpoint.URL, ClientID: "svc"}).ClientCredentials()
+
+	// a 5 second token is inside the default 10 second early expiry window
+	first, _ := source.Token(context.Background())
+	second, err := source.Token(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first.AccessToken == second.AccessToken {
+		t.Fatal("expected a token close to expiry to be replaced")
+	}
+
+	source.EarlyExpiry = time.Second
+	third, _ := source.Token(context.Background())
+	if third.AccessToken != second.AccessToken {
+		t.Fatal("expected token to be cached with a shorter early expiry")
+	}
+}
+
+func TestOAuth2_SingleFlight(t *testing.T) {
+	endpoint := newTokenEndpoint(t)
+	endpoint.delay = 50 * time.Millisecond
+	source := (&webreq.OAuth2Config{TokenURL: endpoint.URL, ClientID: "svc"}).ClientCredentials()
+	client := webreq.NewClient().SetAuth(webreq.NewTokenAuthenticator(source))
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer api.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body, err := webreq.NewRequest("GET").SetURL(api.URL).SetClient(client).Execute()
+			if err != nil || string(body) != "Bearer access-1" {
+				t.Errorf("unexpected response %q: %v", string(body), err)
+			}
+		}()
+	}
+	wg.Wait()
+	if issued := atomic.LoadInt32(&endpoint.issued); issued != 1 {
+		t.Fatalf("expected one token fetch, got %d", issued)
+	}
+}
+
+func TestOAuth2_SharedFetchOutlivesFirstCaller(t *testing.T) {
+	endpoint := newTokenEndpoint(t)
+	endpoint.delay = 100 * time.Millisecond
+	source := (&webreq.OAuth2Config{TokenURL: endpoint.URL, ClientID: "svc"}).ClientCredentials()
+
+	leader, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := source.Token(leader)
+		leaderErr <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	token, err := source.Token(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token.AccessToken != "access-1" {
+		t.Fatalf("unexpected token %q", token.AccessToken)
+	}
+	if err := <-leaderErr; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the first caller to give up on its own deadline, got %v", err)
+	}
+	if issued := atomic.LoadInt32(&endpoint.issued); issued != 1 {
+		t.Fatalf("expected one token fetch, got %d", issued)
+	}
+}
+
+func TestOAuth2_RefreshTokenRotation(t *testing.T) {
+	endpoint := newTokenEndpoint(t)
+	source := (&webreq.OAuth2Config{TokenURL: endpoint.URL, ClientID: "cli"}).RefreshToken("refresh-0")
+
+	first, err := source.Token(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	source.InvalidateToken(first)
+	if _, err := source.Token(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if endpoint.form(0)["grant_type"] != "refresh_token" || endpoint.form(0)["refresh_token"] != "refresh-0" {
+		t.Fatalf("unexpected first refresh: %v", endpoint.form(0))
+	}
+	if endpoint.form(1)["refresh_token"] != "refresh-1" {
+		t.Fatalf("expected rotated refresh token, got %v", endpoint.form(1))
+	}
+}
+
+func TestOAuth2_RejectedTokenIsRefetched(t *testing.T) {
+	endpoint := newTokenEndpoint(t)
+	source := (&webreq.OAuth2Config{TokenURL: endpoint.URL, ClientID: "svc"}).ClientCredentials()
+	client := webreq.NewClient().SetAuth(webreq.NewTokenAuthenticator(source))
+
+	// the API revoked the first token before it expired
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer access-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer api.Close()
+
+	body, err := webreq.NewRequest("GET").SetURL(api.URL).SetClient(client).Execute()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(body) != "Bearer access-2" {
+		t.Fatalf("expected retry with a new token, got %q", string(body))
+	}
+}
+
+func TestOAuth2_ErrorResponse(t *testing.T) {
+	endpoint := newTokenEndpoint(t)
+	endpoint.reply = func(form map[string]string, w http.ResponseWriter) bool {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_client","error_description":"unknown client"}`))
+		return true
+	}
+
+	_, err := (&webreq.OAuth2Config{TokenURL: endpoint.URL, ClientID: "svc"}).ClientCredentials().Token(context.Background())
+	var oauthErr *webreq.OAuth2Error
+	if !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_client" || oauthErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected invalid_client OAuth2Error, got %v", err)
+	}
+}
+
+// decodeJWT verifies the structure of a compact JWS and returns its header and claims
+func decodeJWT(t *testing.T, jwt string) (map[string]interface{}, map[string]interface{}, []byte, []byte) {
+	t.Helper()
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		t.Fatalf("expected 3 JWT parts, got %d", len(parts))
+	}
+	var header, claims map[string]interface{}
+	for i, target := range []*map[string]interface{}{&header, &claims} {
+		raw, err := base64.RawURLEncoding.DecodeString(parts[i])
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := json.Unmarshal(raw, target); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return header, claims, []byte(parts[0] + "." + parts[1]), signature
+}
+
+func TestOAuth2_JWTBearer(t *testing.T) {
+	endpoint := newTokenEndpoint(t)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertion := &webreq.JWTAssertion{
+		Issuer:   "svc@example.com",
+		Subject:  "user@example.com",
+		Audience: endpoint.URL,
+		KeyID:    "key-1",
+		Key:      key,
+		Claims:   map[string]interface{}{"scope": "read"},
+	}
+	source := (&webreq.OAuth2Config{TokenURL: endpoint.URL}).JWTBearer(assertion)
+	if _, err := source.Token(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	form := endpoint.form(0)
+	if form["grant_type"] != webreq.GrantTypeJWTBearer {
+		t.Fatalf("unexpected grant type: %v", form)
+	}
+	header, claims, signed, signature := decodeJWT(t, form["assertion"])
+	if header["alg"] != "RS256" || header["kid"] != "key-1" {
+		t.Fatalf("unexpected header: %v", header)
+	}
+	if claims["iss"] != "svc@example.com" || claims["sub"] != "user@example.com" || claims["aud"] != endpoint.URL || claims["scope"] != "read" {
+		t.Fatalf("unexpected claims: %v", claims)
+	}
+	if claims["exp"].(float64)-claims["iat"].(float64) != webreq.DefaultJWTLifetime.Seconds() {
+		t.Fatalf("unexpected lifetime: %v", claims)
+	}
+	digest := sha256.Sum256(signed)
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+		t.Fatalf("invalid signature: %v", err)
+	}
+}
+
+func TestOAuth2_JWTAssertionES256(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	jwt, err := (&webreq.JWTAssertion{Issuer: "svc", Audience: "https://auth.example.com", Key: key}).Sign()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	header, _, signed, signature := decodeJWT(t, jwt)
+	if header["alg"] != "ES256" || len(signature) != 64 {
+		t.Fatalf("unexpected ES256 JWT: %v, %d byte signature", header, len(signature))
+	}
+	digest := sha256.Sum256(signed)
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(&key.PublicKey, digest[:], r, s) {
+		t.Fatal("invalid signature")
+	}
+}
+
+func TestOAuth2_SharedClientDoesNotRecurse(t *testing.T) {
+	endpoint := newTokenEndpoint(t)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer api.Close()
+
+	// the token endpoint is called through the Client it authenticates
+	client := webreq.NewClient()
+	config := &webreq.OAuth2Config{TokenURL: endpoint.URL, ClientID: "svc", ClientSecret: "s3cret", Client: client}
+	client.SetAuth(webreq.NewTokenAuthenticator(config.ClientCredentials()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	body, err := webreq.NewRequest("GET").SetURL(api.URL).SetClient(client).ExecuteWithContext(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(body) != "Bearer access-1" {
+		t.Fatalf("unexpected credentials %q", body)
+	}
+	if form := endpoint.form(0); form["basic"] != "svc:s3cret" {
+		t.Fatalf("expected the client credentials on the token request, got %v", form)
+	}
+}
+
+func TestOAuth2_ClientSecretSource(t *testing.T) {
+	endpoint := newTokenEndpoint(t)
+	var calls int32
+	config := &webreq.OAuth2Config{
+		TokenURL: endpoint.URL,
+		ClientID: "svc",
+		ClientSecretSource: webreq.SecretFunc(func(ctx context.Context) (string, error) {
+			return "rotated-" + strconv.Itoa(int(atomic.AddInt32(&calls, 1))), nil
+		}),
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := config.ClientCredentials().Token(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if form, want := endpoint.form(i), "svc:rotated-"+strconv.Itoa(i+1); form["basic"] != want {
+			t.Fatalf("expected basic credentials %s, got %v", want, form)
+		}
+	}
+
+	config.ClientSecretSource = webreq.EnvSecret("WEBREQ_TEST_UNSET_SECRET")
+	if _, err := config.ClientCredentials().Token(context.Background()); !errors.Is(err, webreq.ErrSecretNotFound) {
+		t.Fatalf("expected ErrSecretNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,215 @@
+package webreq
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// loginServer is a fake authorization server for the interactive flows
+type loginServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	challenge string
+	polls     []time.Time
+	poll      func(n int) string // error code for the nth device poll, "" issues a token
+}
+
+func newLoginServer(t *testing.T) *loginServer {
+	server := &loginServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/device", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.PostForm.Get("client_id") != "cli" {
+			t.Errorf("unexpected device request: %v", r.PostForm)
+		}
+		_ = json.NewEncoder(w).Encode(DeviceAuthorization{
+			DeviceCode:      "device-1",
+			UserCode:        "ABCD-EFGH",
+			VerificationURI: server.URL + "/activate",
+			ExpiresIn:       30,
+			Interval:        1,
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		form := r.PostForm
+		server.mu.Lock()
+		defer server.mu.Unlock()
+
+		switch form.Get("grant_type") {
+		case GrantTypeAuthorizationCode:
+			sum := sha256.Sum256([]byte(form.Get("code_verifier")))
+			if form.Get("code") != "code-1" || base64.RawURLEncoding.EncodeToString(sum[:]) != server.challenge || form.Get("client_id") != "cli" {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+				return
+			}
+		case GrantTypeDeviceCode:
+			server.polls = append(server.polls, time.Now())
+			if code := server.poll(len(server.polls)); code != "" {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"error":"` + code + `"}`))
+				return
+			}
+		default:
+			t.Errorf("unexpected grant: %v", form)
+		}
+		_, _ = w.Write([]byte(`{"access_token":"user-token","token_type":"Bearer","expires_in":3600,"refresh_token":"user-refresh"}`))
+	})
+	server.Server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (server *loginServer) config() *OAuth2Config {
+	return &OAuth2Config{
+		TokenURL:      server.URL + "/token",
+		AuthURL:       server.URL + "/authorize",
+		DeviceAuthURL: server.URL + "/device",
+		ClientID:      "cli",
+		Scopes:        []string{"openid"},
+	}
+}
+
+// browser returns an open function that completes the login like a user
+// would, with the callback query adjusted by edit
+func (server *loginServer) browser(t *testing.T, edit func(query url.Values)) func(string) error {
+	return func(authURL string) error {
+		parsed, err := url.Parse(authURL)
+		if err != nil {
+			return err
+		}
+		query := parsed.Query()
+		if query.Get("code_challenge_method") != "S256" || query.Get("response_type") != "code" || query.Get("scope") != "openid" {
+			t.Errorf("unexpected authorization url: %s", authURL)
+		}
+		server.mu.Lock()
+		server.challenge = query.Get("code_challenge")
+		server.mu.Unlock()
+
+		callback := url.Values{"code": {"code-1"}, "state": {query.Get("state")}}
+		if edit != nil {
+			edit(callback)
+		}
+		go func() {
+			response, err := http.Get(query.Get("redirect_uri") + "?" + callback.Encode())
+			if err == nil {
+				response.Body.Close()
+			}
+		}()
+		return nil
+	}
+}
+
+func TestAuthorizationCode_PKCE(t *testing.T) {
+	server := newLoginServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	source, err := server.config().AuthorizationCode(ctx, server.browser(t, nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	token, err := source.Token(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token.AccessToken != "user-token" || source.refreshToken != "user-refresh" {
+		t.Fatalf("unexpected token: %+v", token)
+	}
+}
+
+func TestAuthorizationCode_Errors(t *testing.T) {
+	server := newLoginServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := server.config().AuthorizationCode(ctx, server.browser(t, func(query url.Values) {
+		query.Set("state", "forged")
+	}))
+	if !errors.Is(err, ErrLoginStateMismatch) {
+		t.Fatalf("expected state mismatch, got %v", err)
+	}
+
+	_, err = server.config().AuthorizationCode(ctx, server.browser(t, func(query url.Values) {
+		query.Del("code")
+		query.Set("error", "access_denied")
+	}))
+	var oauthErr *OAuth2Error
+	if !errors.As(err, &oauthErr) || oauthErr.Code != "access_denied" {
+		t.Fatalf("expected access_denied, got %v", err)
+	}
+
+	config := server.config()
+	config.RedirectURL = "http://example.com/callback"
+	if _, err := config.AuthorizationCode(ctx, server.browser(t, nil)); err == nil {
+		t.Fatal("expected error for a non loopback redirect url")
+	}
+}
+
+func TestDeviceCode_PollingAndSlowDown(t *testing.T) {
+	defer func(unit time.Duration) { devicePollUnit = unit }(devicePollUnit)
+	devicePollUnit = 10 * time.Millisecond
+
+	server := newLoginServer(t)
+	server.poll = func(n int) string {
+		switch n {
+		case 1:
+			return "authorization_pending"
+		case 2:
+			return "slow_down"
+		}
+		return ""
+	}
+
+	var prompted *DeviceAuthorization
+	source, err := server.config().DeviceCode(context.Background(), func(authorization *DeviceAuthorization) error {
+		prompted = authorization
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if prompted == nil || prompted.UserCode != "ABCD-EFGH" {
+		t.Fatalf("unexpected prompt: %+v", prompted)
+	}
+	if token, _ := source.Token(context.Background()); token.AccessToken != "user-token" {
+		t.Fatalf("unexpected token: %+v", token)
+	}
+
+	if len(server.polls) != 3 {
+		t.Fatalf("expected 3 polls, got %d", len(server.polls))
+	}
+	// slow_down adds 5 units to the 1 unit interval
+	if gap := server.polls[2].Sub(server.polls[1]); gap < 6*devicePollUnit {
+		t.Fatalf("expected slower polling after slow_down, got %s", gap)
+	}
+}
+
+func TestDeviceCode_Expiry(t *testing.T) {
+	defer func(unit time.Duration) { devicePollUnit = unit }(devicePollUnit)
+	devicePollUnit = time.Millisecond
+
+	server := newLoginServer(t)
+	server.poll = func(n int) string { return "authorization_pending" }
+	_, err := server.config().DeviceCode(context.Background(), func(*DeviceAuthorization) error { return nil })
+	if !errors.Is(err, ErrDeviceCodeExpired) {
+		t.Fatalf("expected ErrDeviceCodeExpired, got %v", err)
+	}
+
+	server.poll = func(n int) string { return "access_denied" }
+	_, err = server.config().DeviceCode(context.Background(), func(*DeviceAuthorization) error { return nil })
+	var oauthErr *OAuth2Error
+	if !errors.As(err, &oauthErr) || oauthErr.Code != "access_denied" {
+		t.Fatalf("expected access_denied, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package webreq_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/tonnytg/webreq"
+)
+
+// pinnedRequest targets the server by name, as most pins are set for host names
+func pinnedRequest(url string, config *webreq.TLSConfig) *webreq.Request {
+	return webreq.NewRequest("GET").
+		SetURL(strings.Replace(url, "127.0.0.1", "localhost", 1)).
+		SetClient(webreq.NewClient().SetTLSConfig(config))
+}
+
+func TestPinning_MatchesRootPin(t *testing.T) {
+	ca := newTestCA(t)
+	ts := newTestTLSServer(t, ca, nil, okHandler)
+	defer ts.Close()
+
+	config := webreq.NewTLSConfig().AddPin("localhost", "sha256/"+webreq.SPKIPin(ca.cert))
+	_ = config.AddRootCAPEM(ca.pem)
+
+	if _, err := pinnedRequest(ts.URL, config).Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestPinning_BackupPin(t *testing.T) {
+	ca := newTestCA(t)
+	ts := newTestTLSServer(t, ca, nil, okHandler)
+	defer ts.Close()
+
+	rotated := newTestCA(t)
+	config := webreq.NewTLSConfig().AddPin("*.localhost", "unused").
+		AddPin("localhost", webreq.SPKIPin(rotated.cert), webreq.SPKIPin(ca.cert))
+	_ = config.AddRootCAPEM(ca.pem)
+
+	if _, err := pinnedRequest(ts.URL, config).Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestPinning_MismatchFailsHandshake(t *testing.T) {
+	ca := newTestCA(t)
+	ts := newTestTLSServer(t, ca, nil, okHandler)
+	defer ts.Close()
+
+	var reported *webreq.PinningError
+	config := webreq.NewTLSConfig().
+		AddPin("localhost", webreq.SPKIPin(newTestCA(t).cert)).
+		SetPinMismatchHandler(func(e *webreq.PinningError) { reported = e })
+	_ = config.AddRootCAPEM(ca.pem)
+
+	_, err := pinnedRequest(ts.URL, config).Execute()
+	var pinningError *webreq.PinningError
+	if !errors.As(err, &pinningError) {
+		t.Fatalf("expected PinningError, got %v", err)
+	}
+	if pinningError.Host != "localhost" || len(pinningError.Presented) != 2 {
+		t.Fatalf("unexpected pinning error: %+v", pinningError)
+	}
+	if reported == nil || reported.ReportOnly {
+		t.Fatalf("expected enforced mismatch to be reported, got %+v", reported)
+	}
+}
+
+func TestPinning_ReportOnly(t *testing.T) {
+	ca := newTestCA(t)
+	ts := newTestTLSServer(t, ca, nil, okHandler)
+	defer ts.Close()
+
+	var reported []*webreq.PinningError
+	config := webreq.NewTLSConfig().
+		AddPin("localhost", webreq.SPKIPin(newTestCA(t).cert)).
+		SetPinReportOnly(true).
+		SetPinMismatchHandler(func(e *webreq.PinningError) { reported = append(reported, e) })
+	_ = config.AddRootCAPEM(ca.pem)
+
+	if _, err := pinnedRequest(ts.URL, config).Execute(); err != nil {
+		t.Fatalf("unexpected error in report-only mode: %v", err)
+	}
+	if len(reported) != 1 || !reported[0].ReportOnly {
+		t.Fatalf("expected one report-only mismatch, got %v", reported)
+	}
+}
+
+func TestPinning_UnpinnedHostNotChecked(t *testing.T) {
+	ca := newTestCA(t)
+	ts := newTestTLSServer(t, ca, nil, okHandler)
+	defer ts.Close()
+
+	config := webreq.NewTLSConfig().AddPin("payments.example.com", "unused")
+	_ = config.AddRootCAPEM(ca.pem)
+
+	if _, err := pinnedRequest(ts.URL, config).Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestPinning_IPHost(t *testing.T) {
+	ca := newTestCA(t)
+	ts := newTestTLSServer(t, ca, nil, okHandler)
+	defer ts.Close()
+
+	bogus := webreq.NewTLSConfig().AddPin("127.0.0.1", webreq.SPKIPin(newTestCA(t).cert))
+	_ = bogus.AddRootCAPEM(ca.pem)
+	_, err := webreq.NewRequest("GET").SetURL(ts.URL).SetClient(webreq.NewClient().SetTLSConfig(bogus)).Execute()
+	var pinningError *webreq.PinningError
+	if !errors.As(err, &pinningError) || pinningError.Host != "127.0.0.1" {
+		t.Fatalf("expected PinningError for the IP host, got %v", err)
+	}
+
+	config := webreq.NewTLSConfig().AddPin("127.0.0.1", webreq.SPKIPin(ca.cert))
+	_ = config.AddRootCAPEM(ca.pem)
+	request := webreq.NewRequest("GET").SetURL(ts.URL).SetClient(webreq.NewClient().SetTLSConfig(config))
+	if _, err := request.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if request.Response.Timings.TLSHandshake <= 0 {
+		t.Errorf("expected the handshake to be reported, got %+v", request.Response.Timings)
+	}
+}
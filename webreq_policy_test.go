@@ -0,0 +1,177 @@
+package webreq_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/tonnytg/webreq"
+)
+
+func TestPolicy_Enforce(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+	}))
+	defer ts.Close()
+
+	policy := webreq.NewPolicy(webreq.PolicyRule{
+		Hosts:           []string{"127.0.0.*"},
+		PathPrefixes:    []string{"/v1"},
+		Methods:         []string{"GET", "POST"},
+		MaxBodySize:     8,
+		RequiredHeaders: []string{"X-Service"},
+	})
+	client := webreq.NewClient().SetPolicy(policy).SetHeader("X-Service", "billing")
+
+	allowed := []*webreq.Request{
+		webreq.NewRequest("GET").SetURL(ts.URL + "/v1"),
+		webreq.NewRequest("POST").SetURL(ts.URL + "/v1/users").SetData([]byte("small")),
+	}
+	for _, req := range allowed {
+		if _, err := req.SetClient(client).Execute(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	denied := map[string]*webreq.Request{
+		"method": webreq.NewRequest("DELETE").SetURL(ts.URL + "/v1/users"),
+		"path":   webreq.NewRequest("GET").SetURL(ts.URL + "/v10"),
+		"clean":  webreq.NewRequest("GET").SetURL(ts.URL + "/v1/../admin"),
+		"body":   webreq.NewRequest("POST").SetURL(ts.URL + "/v1").SetData([]byte("far too large")),
+		"host":   webreq.NewRequest("GET").SetURL("http://localhost/v1"),
+	}
+	for name, req := range denied {
+		_, err := req.SetClient(client).Execute()
+		var violation *webreq.PolicyViolation
+		if !errors.As(err, &violation) || !errors.Is(err, webreq.ErrPolicyDenied) {
+			t.Fatalf("%s: expected PolicyViolation, got %v", name, err)
+		}
+	}
+
+	if atomic.LoadInt32(&hits) != int32(len(allowed)) {
+		t.Fatalf("expected %d requests to reach the server, got %d", len(allowed), hits)
+	}
+}
+
+func TestPolicy_RequiredHeaders(t *testing.T) {
+	ts := httptest.NewServer(okHandler)
+	defer ts.Close()
+
+	policy := webreq.NewPolicy(webreq.PolicyRule{RequiredHeaders: []string{"X-Request-Id"}})
+	client := webreq.NewClient().SetPolicy(policy)
+
+	_, err := webreq.NewRequest("GET").SetURL(ts.URL).SetClient(client).Execute()
+	if err == nil || !strings.Contains(err.Error(), "X-Request-Id") {
+		t.Fatalf("expected missing header violation, got %v", err)
+	}
+
+	req := webreq.NewRequest("GET").SetURL(ts.URL).SetClient(client)
+	req.SetHeaders(map[string]string{"X-Request-Id": "42"})
+	if _, err := req.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestPolicy_Audit(t *testing.T) {
+	ts := httptest.NewServer(okHandler)
+	defer ts.Close()
+
+	var violations []*webreq.PolicyViolation
+	policy := webreq.NewPolicy(webreq.PolicyRule{Methods: []string{"GET"}}).
+		SetMode(webreq.PolicyAudit).
+		SetViolationHandler(func(violation *webreq.PolicyViolation) {
+			violations = append(violations, violation)
+		})
+	client := webreq.NewClient().SetPolicy(policy)
+
+	if _, err := webreq.NewRequest("PUT").SetURL(ts.URL).SetClient(client).Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(violations) != 1 || !violations[0].Audit || violations[0].Method != "PUT" {
+		t.Fatalf("expected one audited PUT violation, got %+v", violations)
+	}
+}
+
+func TestPolicy_LoadJSON(t *testing.T) {
+	file := writeFile(t, t.TempDir(), "policy.json", []byte(`{
+		"mode": "audit",
+		"rules": [
+			{"hosts": ["*.example.com"], "path_prefixes": ["/api"], "methods": ["GET"], "max_body_size": 1024, "required_headers": ["X-Service"]}
+		]
+	}`))
+
+	policy, err := webreq.LoadPolicy(file)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if policy.Mode != webreq.PolicyAudit || len(policy.Rules) != 1 {
+		t.Fatalf("unexpected policy: %+v", policy)
+	}
+	rule := policy.Rules[0]
+	if rule.Hosts[0] != "*.example.com" || rule.MaxBodySize != 1024 || rule.RequiredHeaders[0] != "X-Service" {
+		t.Fatalf("unexpected rule: %+v", rule)
+	}
+
+	if _, err := webreq.ParsePolicy([]byte(`{"rules": [{"host": ["typo"]}]}`)); err == nil {
+		t.Fatal("expected error for unknown field")
+	}
+	if _, err := webreq.ParsePolicy([]byte(`{"mode": "permissive"}`)); err == nil {
+		t.Fatal("expected error for unknown mode")
+	}
+}
+
+func TestPolicy_LoadYAML(t *testing.T) {
+	dir := t.TempDir()
+	file := writeFile(t, dir, "policy.yaml", []byte(`
+mode: audit
+rules:
+  - hosts: ["*.example.com"]
+    path_prefixes: [/api]
+    methods: [GET]
+    max_body_size: 1024
+    required_headers: [X-Service]
+`))
+
+	policy, err := webreq.LoadPolicy(file)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if policy.Mode != webreq.PolicyAudit || len(policy.Rules) != 1 {
+		t.Fatalf("unexpected policy: %+v", policy)
+	}
+	rule := policy.Rules[0]
+	if rule.Hosts[0] != "*.example.com" || rule.PathPrefixes[0] != "/api" || rule.MaxBodySize != 1024 || rule.RequiredHeaders[0] != "X-Service" {
+		t.Fatalf("unexpected rule: %+v", rule)
+	}
+
+	if _, err := webreq.LoadPolicy(writeFile(t, dir, "typo.yml", []byte("rules:\n  - host: [typo]\n"))); err == nil {
+		t.Fatal("expected error for unknown field")
+	}
+	if _, err := webreq.ParsePolicyYAML([]byte("mode: permissive\n")); err == nil {
+		t.Fatal("expected error for unknown mode")
+	}
+	if policy, err := webreq.ParsePolicyYAML([]byte("rules: []\n")); err != nil || policy.Mode != webreq.PolicyEnforce {
+		t.Fatalf("expected the enforce default, got %+v, %v", policy, err)
+	}
+}
+
+func TestPolicy_RequiredHeaderFromClientAuth(t *testing.T) {
+	ts := httptest.NewServer(okHandler)
+	defer ts.Close()
+
+	policy := webreq.NewPolicy(webreq.PolicyRule{RequiredHeaders: []string{"Authorization"}})
+	client := webreq.NewClient().SetPolicy(policy).SetAuth(webreq.BearerToken("t0ken"))
+	if _, err := webreq.NewRequest("GET").SetURL(ts.URL).SetClient(client).Execute(); err != nil {
+		t.Fatalf("expected the Authorization header of Client.SetAuth to satisfy the policy, got %v", err)
+	}
+
+	client.SetAuth(nil)
+	_, err := webreq.NewRequest("GET").SetURL(ts.URL).SetClient(client).Execute()
+	if !errors.Is(err, webreq.ErrPolicyDenied) {
+		t.Fatalf("expected ErrPolicyDenied without an Authenticator, got %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+package webreq_test
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/tonnytg/webreq"
+)
+
+// newForwardProxy returns a plain HTTP proxy that answers requests itself
+func newForwardProxy(t *testing.T, hits *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		if !r.URL.IsAbs() {
+			t.Errorf("expected absolute request URI at proxy, got %q", r.RequestURI)
+		}
+		want := "Basic " + base64.StdEncoding.EncodeToString([]byte("alice:s3cret"))
+		if got := r.Header.Get("Proxy-Authorization"); got != want {
+			t.Errorf("unexpected Proxy-Authorization: %q", got)
+		}
+		_, _ = w.Write([]byte("via-proxy " + r.URL.Host))
+	}))
+}
+
+func TestProxy_HTTPWithBasicAuth(t *testing.T) {
+	var hits int32
+	proxy := newForwardProxy(t, &hits)
+	defer proxy.Close()
+
+	config, err := webreq.NewProxyConfig(proxy.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	config.SetBasicAuth("alice", "s3cret")
+
+	req := webreq.NewRequest("GET").SetURL("http://api.internal.test/data")
+	req.SetClient(webreq.NewClient().SetProxy(config))
+
+	body, err := req.Execute()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(body) != "via-proxy api.internal.test" {
+		t.Fatalf("unexpected body: %q", string(body))
+	}
+}
+
+func TestProxy_ConnectHeaders(t *testing.T) {
+	seen := make(chan http.Header, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			t.Errorf("expected CONNECT, got %s", r.Method)
+		}
+		seen <- r.Header.Clone()
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer proxy.Close()
+
+	config, err := webreq.NewProxyConfig(proxy.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	config.SetBasicAuth("alice", "s3cret").SetConnectHeader("X-Proxy-Tenant", "payments")
+
+	req := webreq.NewRequest("GET").SetURL("https://secure.internal.test/")
+	req.SetClient(webreq.NewClient().SetProxy(config))
+
+	if _, err := req.Execute(); err == nil {
+		t.Fatal("expected error when proxy refuses CONNECT")
+	}
+	header := <-seen
+	if got := header.Get("X-Proxy-Tenant"); got != "payments" {
+		t.Errorf("expected custom CONNECT header, got %q", got)
+	}
+	if got := header.Get("Proxy-Authorization"); got == "" {
+		t.Error("expected Proxy-Authorization on CONNECT")
+	}
+}
+
+func TestProxy_RulesSelectPerHost(t *testing.T) {
+	var hits int32
+	proxy := newForwardProxy(t, &hits)
+	defer proxy.Close()
+
+	direct := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("direct"))
+	}))
+	defer direct.Close()
+
+	config := &webreq.ProxyConfig{}
+	proxyURL := "http://alice:s3cret@" + proxy.Listener.Addr().String()
+	if err := config.AddRule("*.internal.test", proxyURL); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := config.AddRule("127.0.0.1", webreq.ProxyDirect); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	client := webreq.NewClient().SetProxy(config)
+
+	body, err := webreq.NewRequest("GET").SetURL(direct.URL).SetClient(client).Execute()
+	if err != nil || string(body) != "direct" {
+		t.Fatalf("expected direct response, got %q, %v", string(body), err)
+	}
+	body, err = webreq.NewRequest("GET").SetURL("http://svc.internal.test/").SetClient(client).Execute()
+	if err != nil || string(body) != "via-proxy svc.internal.test" {
+		t.Fatalf("expected proxied response, got %q, %v", string(body), err)
+	}
+	if atomic.LoadInt32(&hits) != 1 {
+		t.Fatalf("expected exactly one proxied request, got %d", hits)
+	}
+}
+
+func TestProxy_SOCKS5WithAuth(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("through-socks"))
+	}))
+	defer target.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer listener.Close()
+	go serveSOCKS5(t, listener, "bob", "hunter2")
+
+	config, err := webreq.NewProxyConfig("socks5://bob:hunter2@" + listener.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	req := webreq.NewRequest("GET").SetURL(target.URL).SetClient(webreq.NewClient().SetProxy(config))
+	body, err := req.Execute()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(body) != "through-socks" {
+		t.Fatalf("unexpected body: %q", string(body))
+	}
+}
+
+func TestProxy_InvalidScheme(t *testing.T) {
+	if _, err := webreq.NewProxyConfig("ftp://proxy.example.com"); err == nil {
+		t.Fatal("expected error for unsupported proxy scheme")
+	}
+}
+
+// serveSOCKS5 is a minimal RFC 1928/1929 server accepting one username/password
+func serveSOCKS5(t *testing.T, listener net.Listener, username string, password string) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func(conn net.Conn) {
+			defer conn.Close()
+			buf := make([]byte, 262)
+
+			// greeting: version, methods
+			if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+				return
+			}
+			if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte{5, 2})
+
+			// username/password subnegotiation
+			if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+				return
+			}
+			user := make([]byte, buf[1])
+			_, _ = io.ReadFull(conn, user)
+			_, _ = io.ReadFull(conn, buf[:1])
+			pass := make([]byte, buf[0])
+			_, _ = io.ReadFull(conn, pass)
+			if string(user) != username || string(pass) != password {
+				_, _ = conn.Write([]byte{1, 1})
+				return
+			}
+			_, _ = conn.Write([]byte{1, 0})
+
+			// connect request
+			if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+				return
+			}
+			var host string
+			switch buf[3] {
+			case 1:
+				_, _ = io.ReadFull(conn, buf[:4])
+				host = net.IP(buf[:4]).String()
+			case 3:
+				_, _ = io.ReadFull(conn, buf[:1])
+				name := make([]byte, buf[0])
+				_, _ = io.ReadFull(conn, name)
+				host = string(name)
+			default:
+				return
+			}
+			_, _ = io.ReadFull(conn, buf[:2])
+			port := binary.BigEndian.Uint16(buf[:2])
+
+			upstream, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+			if err != nil {
+				_, _ = conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+				return
+			}
+			defer upstream.Close()
+			_, _ = conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+			go func() { _, _ = io.Copy(upstream, conn) }()
+			_, _ = io.Copy(conn, upstream)
+		}(conn)
+	}
+}
@@ -0,0 +1,190 @@
+package webreq_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tonnytg/webreq"
+)
+
+func TestRedirect_ChainRecorded(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/a", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/b", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/b", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/c", http.StatusFound)
+	})
+	mux.HandleFunc("/c", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("done"))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	req := webreq.NewRequest("GET")
+	req.SetURL(ts.URL + "/a")
+	body, err := req.Execute()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(body) != "done" {
+		t.Fatalf("unexpected body: %q", string(body))
+	}
+
+	redirects := req.Response.Redirects
+	if len(redirects) != 2 {
+		t.Fatalf("expected 2 redirects, got %v", redirects)
+	}
+	if redirects[0].URL != ts.URL+"/b" || redirects[0].StatusCode != http.StatusMovedPermanently {
+		t.Errorf("unexpected first hop: %+v", redirects[0])
+	}
+	if redirects[1].URL != ts.URL+"/c" || redirects[1].StatusCode != http.StatusFound {
+		t.Errorf("unexpected second hop: %+v", redirects[1])
+	}
+}
+
+func TestRedirect_MaxRedirects(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, r.URL.Path+"x", http.StatusFound)
+	}))
+	defer ts.Close()
+
+	req := webreq.NewRequest("GET")
+	req.SetURL(ts.URL + "/")
+	req.SetRedirectPolicy(webreq.NewRedirectPolicy().SetMaxRedirects(2))
+
+	_, err := req.Execute()
+	if !errors.Is(err, webreq.ErrTooManyRedirects) {
+		t.Fatalf("expected ErrTooManyRedirects, got %v", err)
+	}
+}
+
+func TestRedirect_DisabledReturnsRedirectResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/elsewhere", http.StatusFound)
+	}))
+	defer ts.Close()
+
+	client := webreq.NewClient().SetRedirectPolicy(webreq.NewRedirectPolicy().SetMaxRedirects(0))
+	req := webreq.NewRequest("GET").SetURL(ts.URL)
+	req.SetClient(client)
+
+	if _, err := req.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if req.StatusCode != http.StatusFound {
+		t.Fatalf("expected 302, got %d", req.StatusCode)
+	}
+	if got := req.Response.Header.Get("Location"); got != "/elsewhere" {
+		t.Fatalf("unexpected Location: %q", got)
+	}
+}
+
+func TestRedirect_HostNotAllowed(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("redirect target should not be reached")
+	}))
+	defer target.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, strings.Replace(target.URL, "127.0.0.1", "localhost", 1), http.StatusFound)
+	}))
+	defer ts.Close()
+
+	req := webreq.NewRequest("GET").SetURL(ts.URL)
+	req.SetRedirectPolicy(webreq.NewRedirectPolicy().AllowHosts("127.0.0.1", "*.example.com"))
+
+	_, err := req.Execute()
+	if !errors.Is(err, webreq.ErrRedirectNotAllowed) {
+		t.Fatalf("expected ErrRedirectNotAllowed, got %v", err)
+	}
+}
+
+func TestRedirect_DowngradeBlocked(t *testing.T) {
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer plain.Close()
+
+	ca := newTestCA(t)
+	secure := newTestTLSServer(t, ca, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, plain.URL, http.StatusFound)
+	}))
+	defer secure.Close()
+
+	config := webreq.NewTLSConfig()
+	if err := config.AddRootCAPEM(ca.pem); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	client := webreq.NewClient().SetTLSConfig(config)
+
+	req := webreq.NewRequest("GET").SetURL(secure.URL).SetClient(client)
+	req.SetRedirectPolicy(webreq.NewRedirectPolicy())
+
+	_, err := req.Execute()
+	if !errors.Is(err, webreq.ErrRedirectDowngrade) {
+		t.Fatalf("expected ErrRedirectDowngrade, got %v", err)
+	}
+}
+
+func TestRedirect_CrossOriginStripsHeaders(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "" {
+			t.Errorf("Authorization leaked across origins: %q", got)
+		}
+		if got := r.Header.Get("X-Api-Key"); got != "" {
+			t.Errorf("X-Api-Key leaked across origins: %q", got)
+		}
+		if got := r.Header.Get("X-Trace"); got != "t-1" {
+			t.Errorf("expected kept header X-Trace, got %q", got)
+		}
+		if got := r.Header.Get("Accept"); got != "application/json" {
+			t.Errorf("expected Accept to survive, got %q", got)
+		}
+	}))
+	defer target.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusFound)
+	}))
+	defer ts.Close()
+
+	req := webreq.NewRequest("GET").SetURL(ts.URL)
+	req.SetHeaders(webreq.HeadersMap{
+		"Authorization": "Bearer secret",
+		"X-Api-Key":     "key",
+		"X-Trace":       "t-1",
+		"Accept":        "application/json",
+	})
+	req.SetRedirectPolicy(webreq.NewRedirectPolicy().KeepCrossOriginHeaders("X-Trace"))
+
+	if _, err := req.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(req.Response.Redirects) != 1 {
+		t.Fatalf("expected one redirect, got %v", req.Response.Redirects)
+	}
+}
+
+func TestRedirect_SameOriginKeepsHeaders(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/a", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/b", http.StatusFound)
+	})
+	mux.HandleFunc("/b", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("expected Authorization on same-origin hop, got %q", got)
+		}
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	req := webreq.NewRequest("GET").SetURL(ts.URL + "/a")
+	req.SetHeaders(webreq.HeadersMap{"Authorization": "Bearer secret"})
+	req.SetRedirectPolicy(webreq.NewRedirectPolicy())
+
+	if _, err := req.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
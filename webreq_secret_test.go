@@ -0,0 +1,152 @@
+package webreq_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tonnytg/webreq"
+)
+
+func TestSecret_EnvResolvedAtSendTime(t *testing.T) {
+	ts := echoAuthServer()
+	defer ts.Close()
+
+	request := webreq.NewRequest("GET").SetURL(ts.URL).SetAuth(webreq.BearerTokenFrom(webreq.EnvSecret("WEBREQ_TEST_TOKEN")))
+	if _, err := request.Execute(); !errors.Is(err, webreq.ErrSecretNotFound) {
+		t.Fatalf("expected ErrSecretNotFound, got %v", err)
+	}
+
+	t.Setenv("WEBREQ_TEST_TOKEN", "first")
+	body, err := request.Execute()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(string(body), "Bearer first|") {
+		t.Errorf("unexpected credentials %q", body)
+	}
+
+	t.Setenv("WEBREQ_TEST_TOKEN", "second")
+	if body, _ = request.Execute(); !strings.HasPrefix(string(body), "Bearer second|") {
+		t.Errorf("expected the changed variable to be used, got %q", body)
+	}
+}
+
+func TestSecret_FileReload(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "api-key", []byte("key-one\n"))
+	secret := webreq.NewFileSecret(path).SetReloadInterval(0)
+
+	value, err := secret.Secret(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if value != "key-one" {
+		t.Errorf("expected the trailing newline to be trimmed, got %q", value)
+	}
+
+	// rotate the way Kubernetes does, replacing the file
+	writeFile(t, dir, "api-key.new", []byte("key-two-rotated"))
+	if err := os.Rename(filepath.Join(dir, "api-key.new"), path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if value, _ = secret.Secret(context.Background()); value != "key-two-rotated" {
+		t.Errorf("expected the rotated key, got %q", value)
+	}
+
+	// the last value is kept while the file is missing
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if value, err = secret.Secret(context.Background()); err != nil || value != "key-two-rotated" {
+		t.Errorf("expected the last value, got %q, %v", value, err)
+	}
+
+	if _, err := webreq.NewFileSecret(filepath.Join(dir, "missing")).Secret(context.Background()); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestSecret_FileReloadInterval(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "token", []byte("cached"))
+	secret := webreq.NewFileSecret(path).SetReloadInterval(time.Hour)
+	if value, _ := secret.Secret(context.Background()); value != "cached" {
+		t.Fatalf("unexpected value %q", value)
+	}
+	writeFile(t, dir, "token", []byte("changed"))
+	if value, _ := secret.Secret(context.Background()); value != "cached" {
+		t.Errorf("expected the file not to be checked within the interval, got %q", value)
+	}
+}
+
+func TestSecret_Command(t *testing.T) {
+	dir := t.TempDir()
+	counter := filepath.Join(dir, "runs")
+	script := "echo run >> " + counter + "; echo '  s3cr3t  '"
+
+	secret := webreq.NewCommandSecret("sh", "-c", script)
+	for i := 0; i < 3; i++ {
+		value, err := secret.Secret(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if value != "s3cr3t" {
+			t.Errorf("expected trimmed output, got %q", value)
+		}
+	}
+	runs, _ := os.ReadFile(counter)
+	if n := strings.Count(string(runs), "run"); n != 1 {
+		t.Errorf("expected the output to be cached, command ran %d times", n)
+	}
+
+	secret.SetTTL(0)
+	_, _ = secret.Secret(context.Background())
+	runs, _ = os.ReadFile(counter)
+	if n := strings.Count(string(runs), "run"); n != 2 {
+		t.Errorf("expected the command to run again without a TTL, ran %d times", n)
+	}
+}
+
+func TestSecret_CommandFailure(t *testing.T) {
+	_, err := webreq.NewCommandSecret("sh", "-c", "echo partial-secret; echo vault is sealed >&2; exit 3").Secret(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "vault is sealed") {
+		t.Fatalf("expected the command's stderr in the error, got %v", err)
+	}
+	if strings.Contains(err.Error(), "partial-secret") {
+		t.Errorf("expected stdout to be left out of the error, got %v", err)
+	}
+
+	if _, err := webreq.NewCommandSecret("true").Secret(context.Background()); !errors.Is(err, webreq.ErrSecretNotFound) {
+		t.Errorf("expected ErrSecretNotFound for empty output, got %v", err)
+	}
+}
+
+func TestSecret_SigningProviders(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "webhook-secret", []byte("whsec_file"))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := webreq.GitHubHMAC([]byte("whsec_file")).Verify(r, body); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	signer := webreq.GitHubHMAC(nil).SetSecretSource(webreq.NewFileSecret(path))
+	request := webreq.NewRequest("POST").SetURL(server.URL).SetData([]byte(`{"ok": true}`)).SetAuth(signer)
+	if _, err := request.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if request.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200, got %d", request.StatusCode)
+	}
+}
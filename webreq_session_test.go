@@ -0,0 +1,209 @@
+package webreq_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tonnytg/webreq"
+)
+
+func newLoginServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc123", Path: "/", HttpOnly: true, MaxAge: 3600})
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/me", func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie("session")
+		if err != nil || cookie.Value != "abc123" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte("tonny"))
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestSession_LoginThenCall(t *testing.T) {
+	ts := newLoginServer(t)
+	defer ts.Close()
+
+	session := webreq.NewSession()
+
+	if _, err := session.NewRequest("POST").SetURL(ts.URL + "/login").Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	req := session.NewRequest("GET").SetURL(ts.URL + "/me")
+	body, err := req.Execute()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if req.StatusCode != http.StatusOK || string(body) != "tonny" {
+		t.Fatalf("expected authenticated call, got %d %q", req.StatusCode, string(body))
+	}
+}
+
+func TestSession_DefaultHeaders(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("X-Tenant"); got != "acme" {
+			t.Errorf("expected default header X-Tenant=acme, got %q", got)
+		}
+		if got := r.Header.Get("Accept"); got != "text/plain" {
+			t.Errorf("expected request header to win, got Accept=%q", got)
+		}
+	}))
+	defer ts.Close()
+
+	session := webreq.NewSession().
+		SetHeader("X-Tenant", "acme").
+		SetHeader("Accept", "application/json")
+
+	req := session.NewRequest("GET").SetURL(ts.URL)
+	req.SetHeaders(webreq.HeadersMap{"Accept": "text/plain"})
+	if _, err := req.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestSession_PersistAndReload(t *testing.T) {
+	ts := newLoginServer(t)
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "cookies.txt")
+
+	session := webreq.NewSession()
+	if err := session.SetCookieFile(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := session.NewRequest("POST").SetURL(ts.URL + "/login").Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := session.Save(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	restored := webreq.NewSession()
+	if err := restored.SetCookieFile(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req := restored.NewRequest("GET").SetURL(ts.URL + "/me")
+	if _, err := req.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if req.StatusCode != http.StatusOK {
+		t.Fatalf("expected restored cookies to authenticate, got %d", req.StatusCode)
+	}
+}
+
+func TestJar_ExportNetscapeFormat(t *testing.T) {
+	jar := webreq.NewJar(nil)
+	u, _ := url.Parse("https://api.example.com/v1/login")
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "token", Value: "t1", Path: "/", Secure: true, Expires: expires},
+		{Name: "sid", Value: "s1", HttpOnly: true},
+	})
+
+	var buf bytes.Buffer
+	if err := jar.Export(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := buf.String()
+
+	wantToken := "api.example.com\tFALSE\t/\tTRUE\t" + strconv.FormatInt(expires.Unix(), 10) + "\ttoken\tt1"
+	if !strings.Contains(out, wantToken) {
+		t.Errorf("missing token line %q in:\n%s", wantToken, out)
+	}
+	if !strings.Contains(out, "#HttpOnly_api.example.com\tFALSE\t/v1\tFALSE\t0\tsid\ts1") {
+		t.Errorf("missing HttpOnly session cookie line in:\n%s", out)
+	}
+}
+
+func TestJar_ImportCurlFile(t *testing.T) {
+	file := "# Netscape HTTP Cookie File\n" +
+		".example.com\tTRUE\t/\tFALSE\t0\tlang\tpt\n" +
+		"old.example.com\tFALSE\t/\tFALSE\t1\tgone\tx\n"
+
+	jar := webreq.NewJar(nil)
+	if err := jar.Import(strings.NewReader(file)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	u, _ := url.Parse("http://example.com/")
+	cookies := jar.Cookies(u)
+	if len(cookies) != 1 || cookies[0].Name != "lang" {
+		t.Fatalf("expected imported lang cookie, got %v", cookies)
+	}
+	if len(jar.AllCookies()) != 1 {
+		t.Fatalf("expected expired cookie to be skipped, got %v", jar.AllCookies())
+	}
+}
+
+func TestJar_RejectsPublicSuffixDomain(t *testing.T) {
+	jar := webreq.NewJar(nil)
+	u, _ := url.Parse("https://www.example.co.uk/")
+	jar.SetCookies(u, []*http.Cookie{{Name: "wide", Value: "1", Domain: "co.uk"}})
+
+	if cookies := jar.AllCookies(); len(cookies) != 0 {
+		t.Fatalf("expected public suffix domain cookie to be rejected, got %v", cookies)
+	}
+	other, _ := url.Parse("https://other.co.uk/")
+	if cookies := jar.Cookies(other); len(cookies) != 0 {
+		t.Fatalf("cookie leaked to another site: %v", cookies)
+	}
+}
+
+func TestJar_DomainCookieForSiblingHost(t *testing.T) {
+	jar := webreq.NewJar(nil)
+	login, _ := url.Parse("https://www.example.com/login")
+	jar.SetCookies(login, []*http.Cookie{{Name: "sid", Value: "s1", Domain: "example.com", Path: "/"}})
+
+	api, _ := url.Parse("https://api.example.com/v1/items")
+	if cookies := jar.Cookies(api); len(cookies) != 1 || cookies[0].Name != "sid" {
+		t.Fatalf("expected the domain cookie on the sibling host, got %v", cookies)
+	}
+
+	var buf bytes.Buffer
+	if err := jar.Export(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), ".example.com\tTRUE\t/\tFALSE\t0\tsid\ts1") {
+		t.Errorf("expected a domain cookie line in:\n%s", buf.String())
+	}
+}
+
+func TestJar_ImportRoundTripHostOnly(t *testing.T) {
+	// a strict list stores include-subdomains lines as host-only cookies,
+	// which Export must then write as such
+	jar := webreq.NewJar(webreq.HostOnlySuffixList)
+	if err := jar.Import(strings.NewReader(".example.com\tTRUE\t/\tFALSE\t0\tlang\tpt\n")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sub, _ := url.Parse("http://www.example.com/")
+	if cookies := jar.Cookies(sub); len(cookies) != 0 {
+		t.Fatalf("expected a host-only cookie, got %v on a subdomain", cookies)
+	}
+
+	var buf bytes.Buffer
+	if err := jar.Export(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "\nexample.com\tFALSE\t/\tFALSE\t0\tlang\tpt\n") {
+		t.Errorf("expected the cookie exported as host-only, got:\n%s", buf.String())
+	}
+}
+
+func TestJar_ImportInvalidLine(t *testing.T) {
+	jar := webreq.NewJar(nil)
+	if err := jar.Import(strings.NewReader("example.com\tTRUE\t/\n")); err == nil {
+		t.Fatal("expected error for malformed line")
+	}
+}
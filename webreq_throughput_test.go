@@ -0,0 +1,109 @@
+package webreq_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tonnytg/webreq"
+)
+
+func TestMinTransferRate_Trickle(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 50; i++ {
+			if _, err := w.Write([]byte("x")); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			time.Sleep(20 * time.Millisecond)
+		}
+	}))
+	defer ts.Close()
+
+	// the body never goes idle for long, but delivers far less than required
+	req := webreq.NewRequest("GET").SetURL(ts.URL)
+	req.SetTimeouts(webreq.Timeouts{BodyIdle: time.Second})
+	req.SetMinTransferRate(1024, 200*time.Millisecond)
+
+	_, err := req.Execute()
+	expectTimeoutPhase(t, err, webreq.TimeoutPhaseTransferRate)
+}
+
+func TestMinTransferRate_FastBody(t *testing.T) {
+	payload := strings.Repeat("x", 64*1024)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(payload))
+	}))
+	defer ts.Close()
+
+	client := webreq.NewClient().SetMinTransferRate(1024, 100*time.Millisecond)
+	req := webreq.NewRequest("GET").SetURL(ts.URL).SetClient(client)
+
+	body, err := req.Execute()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(body) != len(payload) {
+		t.Fatalf("expected %d bytes, got %d", len(payload), len(body))
+	}
+}
+
+func TestMinTransferRate_RequestOverridesClient(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 5; i++ {
+			_, _ = w.Write([]byte("x"))
+			w.(http.Flusher).Flush()
+			time.Sleep(20 * time.Millisecond)
+		}
+	}))
+	defer ts.Close()
+
+	client := webreq.NewClient().SetMinTransferRate(1024, 40*time.Millisecond)
+	req := webreq.NewRequest("GET").SetURL(ts.URL).SetClient(client)
+	req.SetMinTransferRate(1, time.Second)
+
+	if _, err := req.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestMinTransferRate_TinyAndZeroWindow(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	req := webreq.NewRequest("GET").SetURL(ts.URL).SetMinTransferRate(1, 3*time.Nanosecond)
+	if req.MinTransferRate.Window != 100*time.Millisecond {
+		t.Errorf("expected the window to be raised to 100ms, got %v", req.MinTransferRate.Window)
+	}
+	if _, err := req.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	req.MinTransferRate = &webreq.TransferRate{Bytes: 1}
+	if _, err := req.Execute(); err == nil {
+		t.Fatal("expected an error for a zero window")
+	}
+}
+
+func TestMaxResponseHeaderBytes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Padding", strings.Repeat("a", 8*1024))
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	client := webreq.NewClient().SetMaxResponseHeaderBytes(1024)
+	req := webreq.NewRequest("GET").SetURL(ts.URL).SetClient(client)
+	if _, err := req.Execute(); err == nil {
+		t.Fatal("expected error for oversized response headers")
+	}
+
+	client.SetMaxResponseHeaderBytes(64 * 1024)
+	if _, err := req.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package webreq_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tonnytg/webreq"
+)
+
+// blockingResolver never answers until the lookup is cancelled
+type blockingResolver struct{}
+
+func (blockingResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func expectTimeoutPhase(t *testing.T, err error, phase string) {
+	t.Helper()
+	var timeoutError *webreq.TimeoutError
+	if !errors.As(err, &timeoutError) {
+		t.Fatalf("expected TimeoutError, got %v", err)
+	}
+	if timeoutError.Phase != phase {
+		t.Fatalf("expected %s phase, got %s (%v)", phase, timeoutError.Phase, err)
+	}
+}
+
+func TestTimeouts_Dial(t *testing.T) {
+	client := webreq.NewClient().SetResolver(blockingResolver{})
+	req := webreq.NewRequest("GET").SetURL("http://slow-dns.example.com/").SetClient(client)
+	req.SetTimeouts(webreq.Timeouts{Dial: 50 * time.Millisecond})
+
+	_, err := req.Execute()
+	expectTimeoutPhase(t, err, webreq.TimeoutPhaseDial)
+}
+
+func TestTimeouts_TLSHandshake(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	req := webreq.NewRequest("GET").SetURL("https://" + listener.Addr().String() + "/")
+	req.SetTimeouts(webreq.Timeouts{TLSHandshake: 50 * time.Millisecond})
+
+	_, err = req.Execute()
+	expectTimeoutPhase(t, err, webreq.TimeoutPhaseTLSHandshake)
+}
+
+func TestTimeouts_ResponseHeader(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	req := webreq.NewRequest("GET").SetURL(ts.URL)
+	req.SetTimeouts(webreq.Timeouts{ResponseHeader: 50 * time.Millisecond})
+
+	_, err := req.Execute()
+	expectTimeoutPhase(t, err, webreq.TimeoutPhaseResponseHeader)
+}
+
+func TestTimeouts_BodyIdle(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("first chunk"))
+		w.(http.Flusher).Flush()
+		time.Sleep(300 * time.Millisecond)
+		_, _ = w.Write([]byte("too late"))
+	}))
+	defer ts.Close()
+
+	req := webreq.NewRequest("GET").SetURL(ts.URL)
+	req.SetTimeouts(webreq.Timeouts{BodyIdle: 50 * time.Millisecond})
+
+	_, err := req.Execute()
+	expectTimeoutPhase(t, err, webreq.TimeoutPhaseBodyIdle)
+}
+
+func TestTimeouts_SlowButProgressingBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 10; i++ {
+			_, _ = w.Write([]byte("x"))
+			w.(http.Flusher).Flush()
+			time.Sleep(20 * time.Millisecond)
+		}
+	}))
+	defer ts.Close()
+
+	req := webreq.NewRequest("GET").SetURL(ts.URL)
+	req.SetTimeouts(webreq.Timeouts{BodyIdle: 150 * time.Millisecond})
+
+	body, err := req.Execute()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(body) != "xxxxxxxxxx" {
+		t.Fatalf("unexpected body: %q", string(body))
+	}
+}
+
+func TestTimeouts_Overall(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	client := webreq.NewClient().SetTimeouts(webreq.Timeouts{Overall: 50 * time.Millisecond})
+	req := webreq.NewRequest("GET").SetURL(ts.URL).SetClient(client)
+
+	_, err := req.Execute()
+	expectTimeoutPhase(t, err, webreq.TimeoutPhaseOverall)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected overall timeout to wrap context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestTimeouts_CallerDeadlineIsNotOverall(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	client := webreq.NewClient().SetTimeouts(webreq.Timeouts{Overall: 30 * time.Second})
+	req := webreq.NewRequest("GET").SetURL(ts.URL).SetClient(client)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := req.ExecuteWithContext(ctx)
+	var timeoutError *webreq.TimeoutError
+	if errors.As(err, &timeoutError) {
+		t.Fatalf("expected the caller's deadline, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestTimeouts_RequestOverridesClient(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	client := webreq.NewClient().SetTimeouts(webreq.Timeouts{ResponseHeader: 20 * time.Millisecond})
+	req := webreq.NewRequest("GET").SetURL(ts.URL).SetClient(client)
+	req.SetTimeouts(webreq.Timeouts{ResponseHeader: time.Second})
+
+	if _, err := req.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package webreq_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tonnytg/webreq"
+)
+
+// slowResolver answers from a staticResolver after a delay
+type slowResolver struct {
+	delay    time.Duration
+	resolver staticResolver
+}
+
+func (r slowResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	time.Sleep(r.delay)
+	return r.resolver.LookupHost(ctx, host)
+}
+
+func TestTimings_ServerAndBodyTransfer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		_, _ = w.Write([]byte("first"))
+		w.(http.Flusher).Flush()
+		time.Sleep(50 * time.Millisecond)
+		_, _ = w.Write([]byte("second"))
+	}))
+	defer server.Close()
+
+	request := webreq.NewRequest("GET").SetURL(server.URL).SetClient(webreq.NewClient())
+	if _, err := request.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	timings := request.Response.Timings
+	if timings.TimeToFirstByte < 50*time.Millisecond {
+		t.Errorf("expected the server delay in TimeToFirstByte, got %v", timings.TimeToFirstByte)
+	}
+	if timings.BodyTransfer < 50*time.Millisecond {
+		t.Errorf("expected the streaming delay in BodyTransfer, got %v", timings.BodyTransfer)
+	}
+	if timings.Total < timings.TimeToFirstByte+timings.BodyTransfer {
+		t.Errorf("expected Total to cover the phases, got %+v", timings)
+	}
+	if timings.Connect <= 0 || timings.ConnectionReused {
+		t.Errorf("expected a new connection, got %+v", timings)
+	}
+	if timings.DNSLookup != 0 || timings.TLSHandshake != 0 {
+		t.Errorf("expected no lookup or handshake for a plain IP URL, got %+v", timings)
+	}
+	if timings.RemoteAddr != server.Listener.Addr().String() {
+		t.Errorf("expected RemoteAddr %s, got %s", server.Listener.Addr(), timings.RemoteAddr)
+	}
+}
+
+func TestTimings_ConnectionReused(t *testing.T) {
+	server := httptest.NewServer(okHandler)
+	defer server.Close()
+
+	client := webreq.NewClient()
+	first := webreq.NewRequest("GET").SetURL(server.URL).SetClient(client)
+	if _, err := first.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second := webreq.NewRequest("GET").SetURL(server.URL).SetClient(client)
+	if _, err := second.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if first.Response.Timings.ConnectionReused {
+		t.Error("expected the first request to open a connection")
+	}
+	if timings := second.Response.Timings; !timings.ConnectionReused || timings.Connect != 0 {
+		t.Errorf("expected the second request to reuse the connection, got %+v", timings)
+	}
+}
+
+func TestTimings_DNSAndTLSHandshake(t *testing.T) {
+	ca := newTestCA(t)
+	ts := newTestTLSServer(t, ca, nil, okHandler)
+	defer ts.Close()
+
+	config := webreq.NewTLSConfig()
+	if err := config.AddRootCAPEM(ca.pem); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, port, _ := strings.Cut(strings.TrimPrefix(ts.URL, "https://"), ":")
+	client := webreq.NewClient().SetTLSConfig(config).
+		SetResolver(slowResolver{delay: 30 * time.Millisecond, resolver: staticResolver{"api.example.com": {"127.0.0.1"}}})
+
+	request := webreq.NewRequest("GET").SetURL("https://api.example.com:" + port).SetClient(client)
+	if _, err := request.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	timings := request.Response.Timings
+	if timings.DNSLookup < 30*time.Millisecond {
+		t.Errorf("expected the resolver delay in DNSLookup, got %v", timings.DNSLookup)
+	}
+	if timings.TLSHandshake <= 0 {
+		t.Errorf("expected a TLS handshake, got %+v", timings)
+	}
+}
+
+func TestTimings_ClientStats(t *testing.T) {
+	server := httptest.NewServer(okHandler)
+	defer server.Close()
+
+	client := webreq.NewClient()
+	for i := 0; i < 2; i++ {
+		if _, err := webreq.NewRequest("GET").SetURL(server.URL).SetClient(client).Execute(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if stats := client.TimingStats(); stats.Requests != 0 {
+		t.Fatalf("expected no stats without CollectTimings, got %+v", stats)
+	}
+
+	client.SetCollectTimings(true)
+	for i := 0; i < 3; i++ {
+		if _, err := webreq.NewRequest("GET").SetURL(server.URL).SetClient(client).Execute(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	stats := client.TimingStats()
+	if stats.Requests != 3 || stats.ReusedConnections != 3 {
+		t.Errorf("expected 3 requests over reused connections, got %+v", stats)
+	}
+	if average := stats.Average(); average.Total <= 0 || average.Total > stats.Total {
+		t.Errorf("unexpected average %+v of %+v", average, stats)
+	}
+
+	client.ResetTimingStats()
+	if stats := client.TimingStats(); stats.Requests != 0 || stats.Total != 0 {
+		t.Errorf("expected the stats to be cleared, got %+v", stats)
+	}
+}
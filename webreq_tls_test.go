@@ -0,0 +1,285 @@
+package webreq_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tonnytg/webreq"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// testCA issues certificates for TLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "webreq test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue returns PEM encoded certificate and key signed by the CA
+func (ca *testCA) issue(t *testing.T, commonName string, client bool) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{commonName, "localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if client {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// newTestTLSServer starts a server presenting a certificate issued by ca
+func newTestTLSServer(t *testing.T, ca *testCA, config *tls.Config, handler http.Handler) *httptest.Server {
+	certPEM, keyPEM := ca.issue(t, "api.example.com", false)
+	certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config == nil {
+		config = &tls.Config{}
+	}
+	config.Certificates = []tls.Certificate{certificate}
+
+	ts := httptest.NewUnstartedServer(handler)
+	ts.TLS = config
+	ts.StartTLS()
+	return ts
+}
+
+func writeFile(t *testing.T, dir string, name string, data []byte) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return path
+}
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	_, _ = w.Write([]byte("secure"))
+})
+
+func TestTLS_CustomRootCAFile(t *testing.T) {
+	ca := newTestCA(t)
+	ts := newTestTLSServer(t, ca, nil, okHandler)
+	defer ts.Close()
+
+	if _, err := webreq.NewRequest("GET").SetURL(ts.URL).SetClient(webreq.NewClient()).Execute(); err == nil {
+		t.Fatal("expected verification error without custom CA")
+	}
+
+	config := webreq.NewTLSConfig()
+	if err := config.AddRootCAFile(writeFile(t, t.TempDir(), "ca.pem", ca.pem)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, err := webreq.NewRequest("GET").SetURL(ts.URL).SetClient(webreq.NewClient().SetTLSConfig(config)).Execute()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(body) != "secure" {
+		t.Fatalf("unexpected body: %q", string(body))
+	}
+}
+
+func TestTLS_RootCADir(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "first.crt", newTestCA(t).pem)
+	writeFile(t, dir, "second.pem", newTestCA(t).pem)
+	writeFile(t, dir, "README", []byte("not a certificate"))
+
+	config := webreq.NewTLSConfig()
+	if err := config.AddRootCADir(dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(config.RootCAs) != 2 {
+		t.Fatalf("expected 2 roots, got %d", len(config.RootCAs))
+	}
+	if err := webreq.NewTLSConfig().AddRootCADir(t.TempDir()); err == nil {
+		t.Fatal("expected error for directory without certificates")
+	}
+}
+
+func TestTLS_ClientCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	ts := newTestTLSServer(t, ca, &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	certPEM, keyPEM := ca.issue(t, "billing-service", true)
+
+	config := webreq.NewTLSConfig()
+	if err := config.AddRootCAPEM(ca.pem); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := config.LoadClientCertificate(writeFile(t, dir, "client.crt", certPEM), writeFile(t, dir, "client.key", keyPEM)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	body, err := webreq.NewRequest("GET").SetURL(ts.URL).SetClient(webreq.NewClient().SetTLSConfig(config)).Execute()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(body) != "billing-service" {
+		t.Fatalf("unexpected peer: %q", string(body))
+	}
+}
+
+func TestTLS_ClientCertificatePKCS12(t *testing.T) {
+	ca := newTestCA(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	ts := newTestTLSServer(t, ca, &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	defer ts.Close()
+
+	certificate, err := tls.X509KeyPair(ca.issue(t, "billing-service", true))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pfx, err := pkcs12.Encode(rand.Reader, certificate.PrivateKey, leaf, []*x509.Certificate{ca.cert}, "secret")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	path := writeFile(t, t.TempDir(), "client.p12", pfx)
+
+	config := webreq.NewTLSConfig()
+	if err := config.LoadClientCertificatePKCS12(path, "wrong"); err == nil {
+		t.Fatal("expected error for a wrong password")
+	}
+	if err := config.AddRootCAPEM(ca.pem); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := config.LoadClientCertificatePKCS12(path, "secret"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if chain := config.Certificates[0].Certificate; len(chain) != 2 {
+		t.Fatalf("expected the leaf and the bundled CA, got %d certificates", len(chain))
+	}
+
+	body, err := webreq.NewRequest("GET").SetURL(ts.URL).SetClient(webreq.NewClient().SetTLSConfig(config)).Execute()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(body) != "billing-service" {
+		t.Fatalf("unexpected peer: %q", string(body))
+	}
+}
+
+func TestTLS_MinVersion(t *testing.T) {
+	ca := newTestCA(t)
+	ts := newTestTLSServer(t, ca, &tls.Config{MaxVersion: tls.VersionTLS12}, okHandler)
+	defer ts.Close()
+
+	config := webreq.NewTLSConfig().SetMinVersion(tls.VersionTLS13)
+	_ = config.AddRootCAPEM(ca.pem)
+
+	if _, err := webreq.NewRequest("GET").SetURL(ts.URL).SetClient(webreq.NewClient().SetTLSConfig(config)).Execute(); err == nil {
+		t.Fatal("expected handshake failure below minimum version")
+	}
+}
+
+func TestTLS_ServerNameOverride(t *testing.T) {
+	ca := newTestCA(t)
+	serverNames := make(chan string, 1)
+	ts := newTestTLSServer(t, ca, &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverNames <- hello.ServerName
+			return nil, nil
+		},
+	}, okHandler)
+	defer ts.Close()
+
+	config := webreq.NewTLSConfig().SetServerName("api.example.com")
+	_ = config.AddRootCAPEM(ca.pem)
+
+	if _, err := webreq.NewRequest("GET").SetURL(ts.URL).SetClient(webreq.NewClient().SetTLSConfig(config)).Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := <-serverNames; got != "api.example.com" {
+		t.Fatalf("expected SNI api.example.com, got %q", got)
+	}
+}
+
+func TestTLS_DangerouslySkipCertificateVerification(t *testing.T) {
+	ts := newTestTLSServer(t, newTestCA(t), nil, okHandler)
+	defer ts.Close()
+
+	config := webreq.NewTLSConfig().DangerouslySkipCertificateVerification()
+	if _, err := webreq.NewRequest("GET").SetURL(ts.URL).SetClient(webreq.NewClient().SetTLSConfig(config)).Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
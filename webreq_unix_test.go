@@ -0,0 +1,135 @@
+package webreq_test
+
+import (
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/tonnytg/webreq"
+)
+
+// newUnixServer serves handler on a socket in a short temporary directory,
+// as socket paths are limited to about 100 bytes
+func newUnixServer(t *testing.T, handler http.Handler) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets are not available")
+	}
+	dir, err := os.MkdirTemp("", "webreq")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	socket := filepath.Join(dir, "api.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	server := &http.Server{Handler: handler}
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(func() {
+		server.Close()
+		os.RemoveAll(dir)
+	})
+	return socket
+}
+
+var dockerHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1.43/containers/json" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`[{"Id":"abc"}]`))
+})
+
+func TestUnixSocket_ClientOption(t *testing.T) {
+	socket := newUnixServer(t, dockerHandler)
+
+	req := webreq.NewRequest("GET").
+		SetURL("http://docker/v1.43/containers/json").
+		SetClient(webreq.NewClient().SetUnixSocket(socket))
+
+	body, err := req.Execute()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if req.StatusCode != http.StatusOK || string(body) != `[{"Id":"abc"}]` {
+		t.Fatalf("unexpected response: %d %q", req.StatusCode, string(body))
+	}
+	if got := req.Response.Header.Get("Content-Type"); got != "application/json" {
+		t.Fatalf("unexpected Content-Type: %q", got)
+	}
+}
+
+func TestUnixSocket_URLScheme(t *testing.T) {
+	socket := newUnixServer(t, dockerHandler)
+
+	req := webreq.NewRequest("GET").SetURL(webreq.UnixSocketURL(socket, "/v1.43/containers/json"))
+	if _, err := req.Execute(); err == nil {
+		t.Fatal("expected http+unix URLs to need an opted-in Client")
+	}
+
+	req.SetClient(webreq.NewClient().SetUnixSocketURLs(true))
+	body, err := req.Execute()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(body) != `[{"Id":"abc"}]` {
+		t.Fatalf("unexpected body: %q", string(body))
+	}
+}
+
+func TestUnixSocket_URLSchemeWithClient(t *testing.T) {
+	socket := newUnixServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Host))
+	}))
+
+	req := webreq.NewRequest("GET").
+		SetURL(webreq.UnixSocketURL(socket, "/_ping")).
+		SetClient(webreq.NewClient().SetUnixSocketURLs(true))
+	body, err := req.Execute()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(body) != "localhost" {
+		t.Fatalf("unexpected Host header: %q", string(body))
+	}
+}
+
+func TestUnixSocket_MissingSocket(t *testing.T) {
+	req := webreq.NewRequest("GET").
+		SetURL("http://docker/_ping").
+		SetClient(webreq.NewClient().SetUnixSocket(filepath.Join(t.TempDir(), "missing.sock")))
+	if _, err := req.Execute(); err == nil {
+		t.Fatal("expected error for missing socket")
+	}
+}
+
+func TestUnixSocket_RedirectRefused(t *testing.T) {
+	socket := newUnixServer(t, dockerHandler)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the hex host form is what the transport decodes
+		http.Redirect(w, r, webreq.SchemeHTTPUnix+"://"+hex.EncodeToString([]byte(socket))+"/v1.43/containers/json", http.StatusFound)
+	}))
+	defer ts.Close()
+
+	for name, client := range map[string]*webreq.Client{
+		"default":  nil,
+		"opted in": webreq.NewClient().SetUnixSocketURLs(true),
+		"policy":   webreq.NewClient().SetUnixSocketURLs(true).SetRedirectPolicy(webreq.NewRedirectPolicy().AllowSchemes("http", webreq.SchemeHTTPUnix)),
+	} {
+		req := webreq.NewRequest("GET").SetURL(ts.URL)
+		if client != nil {
+			req.SetClient(client)
+		}
+		body, err := req.Execute()
+		if !errors.Is(err, webreq.ErrRedirectNotAllowed) {
+			t.Errorf("%s: expected the redirect to be refused, got %v and %q", name, err, body)
+		}
+	}
+}